@@ -0,0 +1,12 @@
+package com.invisirisk.demo;
+
+import org.slf4j.Logger;
+import org.slf4j.LoggerFactory;
+
+public class App {
+    private static final Logger log = LoggerFactory.getLogger(App.class);
+
+    public static void main(String[] args) {
+        log.info("built through PSE");
+    }
+}
@@ -0,0 +1,639 @@
+// Package brotli decompresses the brotli format of RFC 7932, the br content
+// encoding.
+package brotli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrCorrupt is returned for streams that are not valid brotli.
+var ErrCorrupt = errors.New("brotli: corrupt input")
+
+// NewReader returns a reader of the data r decompresses to. Decoding runs
+// in a goroutine that stops when the result is read to the end or closed.
+func NewReader(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		d := &decoder{in: bitReader{r: bufio.NewReader(r)}, out: pw}
+		pw.CloseWithError(d.decode())
+	}()
+	return pr
+}
+
+// failure carries a decoding error up to decode.
+type failure struct{ err error }
+
+// bug is a recovered runtime panic, reported as a corrupt stream.
+type bug struct{ r interface{} }
+
+func (b bug) Error() string        { return fmt.Sprintf("%v: %v", ErrCorrupt, b.r) }
+func (b bug) Is(target error) bool { return target == ErrCorrupt }
+
+// Unwrap returns the runtime error, if the panic was one.
+func (b bug) Unwrap() error {
+	err, _ := b.r.(error)
+	return err
+}
+
+func fail(err error) {
+	panic(failure{err})
+}
+
+func corrupt(format string, args ...interface{}) {
+	fail(fmt.Errorf("%w: "+format, append([]interface{}{ErrCorrupt}, args...)...))
+}
+
+// bitReader reads the stream least significant bit first.
+type bitReader struct {
+	r   io.ByteReader
+	val uint64
+	n   uint
+}
+
+func (b *bitReader) bits(n uint) int {
+	for b.n < n {
+		c, err := b.r.ReadByte()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			fail(err)
+		}
+		b.val |= uint64(c) << b.n
+		b.n += 8
+	}
+	v := int(b.val & (1<<n - 1))
+	b.val >>= n
+	b.n -= n
+	return v
+}
+
+// align skips to the next byte boundary, where the skipped bits must be
+// zero.
+func (b *bitReader) align() {
+	if b.bits(b.n%8) != 0 {
+		corrupt("non-zero padding")
+	}
+}
+
+// byte reads a byte after align.
+func (b *bitReader) byte() byte {
+	return byte(b.bits(8))
+}
+
+// huffman is a canonical prefix code.
+type huffman struct {
+	// count holds the number of codes of each length.
+	count [16]int
+	// symbols are ordered by code.
+	symbols []int
+}
+
+func newHuffman(lengths []int) *huffman {
+	h := &huffman{}
+	for _, l := range lengths {
+		h.count[l]++
+	}
+	h.count[0] = 0
+	var offs [16]int
+	for l := 1; l < 16; l++ {
+		offs[l] = offs[l-1] + h.count[l-1]
+	}
+	h.symbols = make([]int, offs[15]+h.count[15])
+	for s, l := range lengths {
+		if l != 0 {
+			h.symbols[offs[l]] = s
+			offs[l]++
+		}
+	}
+	return h
+}
+
+func (b *bitReader) symbol(h *huffman) int {
+	// A code of one symbol takes no bits.
+	if len(h.symbols) == 1 {
+		return h.symbols[0]
+	}
+	code, first, index := 0, 0, 0
+	for l := 1; l < 16; l++ {
+		code |= b.bits(1)
+		if n := h.count[l]; code-first < n {
+			return h.symbols[index+code-first]
+		}
+		index += h.count[l]
+		first = (first + h.count[l]) << 1
+		code <<= 1
+	}
+	corrupt("invalid prefix code")
+	return 0
+}
+
+var codeLengthOrder = [18]int{1, 2, 3, 4, 0, 5, 17, 6, 16, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// prefixCode reads a prefix code over an alphabet of size symbols.
+func (b *bitReader) prefixCode(size int) *huffman {
+	lengths := make([]int, size)
+	hskip := b.bits(2)
+	if hskip == 1 {
+		return b.simplePrefixCode(lengths)
+	}
+
+	var clen [18]int
+	space, num := 32, 0
+	for i := hskip; i < len(clen); i++ {
+		var v int
+		switch b.bits(2) {
+		case 0:
+			v = 0
+		case 1:
+			v = 4
+		case 2:
+			v = 3
+		default:
+			switch {
+			case b.bits(1) == 0:
+				v = 2
+			case b.bits(1) == 0:
+				v = 1
+			default:
+				v = 5
+			}
+		}
+		clen[codeLengthOrder[i]] = v
+		if v != 0 {
+			space -= 32 >> v
+			num++
+			if space <= 0 {
+				break
+			}
+		}
+	}
+	if num != 1 && space != 0 {
+		corrupt("invalid code length code")
+	}
+	clenCode := newHuffman(clen[:])
+
+	prev, repeat, repeatLen := 8, 0, 0
+	space = 32768
+	for s := 0; s < size && space > 0; {
+		c := b.symbol(clenCode)
+		if c < 16 {
+			repeat = 0
+			lengths[s] = c
+			s++
+			if c != 0 {
+				prev = c
+				space -= 32768 >> c
+			}
+			continue
+		}
+		extra, l := uint(2), prev
+		if c == 17 {
+			extra, l = 3, 0
+		}
+		if repeatLen != l {
+			repeat, repeatLen = 0, l
+		}
+		old := repeat
+		if repeat > 0 {
+			repeat = (repeat - 2) << extra
+		}
+		repeat += b.bits(extra) + 3
+		delta := repeat - old
+		if s+delta > size {
+			corrupt("code length repeat overflows alphabet")
+		}
+		for end := s + delta; s < end; s++ {
+			lengths[s] = l
+		}
+		if l != 0 {
+			space -= delta << (15 - l)
+		}
+	}
+	if space != 0 {
+		corrupt("invalid code lengths")
+	}
+	return newHuffman(lengths)
+}
+
+func (b *bitReader) simplePrefixCode(lengths []int) *huffman {
+	var bits uint
+	for (len(lengths)-1)>>bits != 0 {
+		bits++
+	}
+	nsym := b.bits(2) + 1
+	syms := make([]int, nsym)
+	for i := range syms {
+		s := b.bits(bits)
+		if s >= len(lengths) || lengths[s] != 0 {
+			corrupt("invalid simple prefix code")
+		}
+		syms[i] = s
+		lengths[s] = -1
+	}
+	var l []int
+	switch nsym {
+	case 1:
+		return &huffman{symbols: syms}
+	case 2:
+		l = []int{1, 1}
+	case 3:
+		l = []int{1, 2, 2}
+	default:
+		if b.bits(1) == 0 {
+			l = []int{2, 2, 2, 2}
+		} else {
+			l = []int{1, 2, 3, 3}
+		}
+	}
+	for i, s := range syms {
+		lengths[s] = l[i]
+	}
+	return newHuffman(lengths)
+}
+
+// varLen reads a count between 1 and 256.
+func (b *bitReader) varLen() int {
+	if b.bits(1) == 0 {
+		return 1
+	}
+	n := uint(b.bits(3))
+	return 1<<n + b.bits(n) + 1
+}
+
+var (
+	blockCountBase  = [26]int{1, 5, 9, 13, 17, 25, 33, 41, 49, 65, 81, 97, 113, 145, 177, 209, 241, 305, 369, 497, 753, 1265, 2289, 4337, 8433, 16625}
+	blockCountExtra = [26]uint{2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 6, 6, 7, 8, 9, 10, 11, 12, 13, 24}
+
+	insertBase  = [24]int{0, 1, 2, 3, 4, 5, 6, 8, 10, 14, 18, 26, 34, 50, 66, 98, 130, 194, 322, 578, 1090, 2114, 6210, 22594}
+	insertExtra = [24]uint{0, 0, 0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 7, 8, 9, 10, 12, 14, 24}
+	copyBase    = [24]int{2, 3, 4, 5, 6, 7, 8, 9, 10, 12, 14, 18, 22, 30, 38, 54, 70, 102, 134, 198, 326, 582, 1094, 2118}
+	copyExtra   = [24]uint{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 7, 8, 9, 10, 24}
+
+	// The insert and copy length codes of each block of 64 commands.
+	cellInsert = [11]int{0, 0, 0, 0, 8, 8, 0, 16, 8, 16, 16}
+	cellCopy   = [11]int{0, 8, 0, 8, 0, 8, 16, 0, 16, 8, 16}
+)
+
+// blocks tracks the block type and count of one category of symbols.
+type blocks struct {
+	n               int
+	types, counts   *huffman
+	typ, prev, left int
+}
+
+func (b *bitReader) blocks() *blocks {
+	bl := &blocks{n: b.varLen(), prev: 1, left: 1 << 30}
+	if bl.n >= 2 {
+		bl.types = b.prefixCode(bl.n + 2)
+		bl.counts = b.prefixCode(26)
+		bl.left = b.blockCount(bl.counts)
+	}
+	return bl
+}
+
+func (b *bitReader) blockCount(h *huffman) int {
+	c := b.symbol(h)
+	return blockCountBase[c] + b.bits(blockCountExtra[c])
+}
+
+// next accounts for one symbol of the category, switching blocks first if
+// the current one is used up.
+func (b *bitReader) next(bl *blocks) {
+	if bl.left == 0 {
+		t := b.symbol(bl.types)
+		switch t {
+		case 0:
+			t = bl.prev
+		case 1:
+			t = bl.typ + 1
+		default:
+			t -= 2
+		}
+		if t >= bl.n {
+			t -= bl.n
+		}
+		bl.prev, bl.typ = bl.typ, t
+		bl.left = b.blockCount(bl.counts)
+	}
+	bl.left--
+}
+
+// contextMap reads the map of size contexts to trees trees.
+func (b *bitReader) contextMap(size, trees int) []int {
+	m := make([]int, size)
+	if trees < 2 {
+		return m
+	}
+	rleMax := 0
+	if b.bits(1) == 1 {
+		rleMax = b.bits(4) + 1
+	}
+	h := b.prefixCode(trees + rleMax)
+	for i := 0; i < size; {
+		switch s := b.symbol(h); {
+		case s == 0:
+			i++
+		case s <= rleMax:
+			n := 1<<uint(s) + b.bits(uint(s))
+			if i+n > size {
+				corrupt("context map run overflows")
+			}
+			i += n
+		default:
+			m[i] = s - rleMax
+			i++
+		}
+	}
+	if b.bits(1) == 1 {
+		// Undo the move-to-front transform.
+		var mtf [256]int
+		for i := range mtf {
+			mtf[i] = i
+		}
+		for i, idx := range m {
+			v := mtf[idx]
+			m[i] = v
+			copy(mtf[1:idx+1], mtf[:idx])
+			mtf[0] = v
+		}
+	}
+	return m
+}
+
+// minWin is the window allocated at first; it grows as output is produced.
+const minWin = 64 << 10
+
+type decoder struct {
+	in  bitReader
+	out io.Writer
+
+	// win holds the most recent output, growing up to the window size.
+	win     []byte
+	maxWin  int
+	pos     int
+	flushed int
+	// dist holds the last four distances, most recent first.
+	dist [4]int
+}
+
+func (d *decoder) decode() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(failure)
+			if !ok {
+				// A bug must not take down the process reading the
+				// stream; report it as a corrupt stream instead.
+				f.err = bug{r}
+			}
+			err = f.err
+		}
+	}()
+
+	wbits := 17
+	if d.in.bits(1) == 0 {
+		wbits = 16
+	} else if n := d.in.bits(3); n != 0 {
+		wbits = 17 + n
+	} else if n := d.in.bits(3); n == 1 {
+		corrupt("large window brotli")
+	} else if n != 0 {
+		wbits = 8 + n
+	}
+	d.maxWin = 1 << uint(wbits)
+	d.win = make([]byte, minWin)
+	if d.maxWin < minWin {
+		d.win = d.win[:d.maxWin]
+	}
+	d.dist = [4]int{4, 11, 15, 16}
+
+	for last := false; !last; {
+		last = d.metaBlock()
+	}
+	d.in.align()
+	d.flush()
+	return nil
+}
+
+// put appends b to the output.
+func (d *decoder) put(b byte) {
+	d.win[d.pos&(len(d.win)-1)] = b
+	d.pos++
+	if d.pos&(len(d.win)-1) == 0 {
+		d.flush()
+		if len(d.win) < d.maxWin {
+			// Nothing has wrapped yet, so the window keeps its layout.
+			win := make([]byte, 2*len(d.win))
+			copy(win, d.win)
+			d.win = win
+		}
+	}
+}
+
+func (d *decoder) flush() {
+	if d.pos == d.flushed {
+		return
+	}
+	start := d.flushed & (len(d.win) - 1)
+	end := start + d.pos - d.flushed
+	if _, err := d.out.Write(d.win[start:end]); err != nil {
+		fail(err)
+	}
+	d.flushed = d.pos
+}
+
+// metaBlock decodes a meta-block and reports whether it was the last.
+func (d *decoder) metaBlock() bool {
+	in := &d.in
+	last := in.bits(1) == 1
+	if last && in.bits(1) == 1 {
+		return true
+	}
+	nibbles := in.bits(2) + 4
+	if nibbles == 7 {
+		// Metadata, which is skipped.
+		if in.bits(1) != 0 {
+			corrupt("reserved bit set")
+		}
+		nbytes := in.bits(2)
+		skip := 0
+		for i := 0; i < nbytes; i++ {
+			b := in.bits(8)
+			if i == nbytes-1 && nbytes > 1 && b == 0 {
+				corrupt("invalid metadata length")
+			}
+			skip |= b << uint(8*i)
+		}
+		if nbytes > 0 {
+			skip++
+		}
+		in.align()
+		for ; skip > 0; skip-- {
+			in.byte()
+		}
+		return last
+	}
+	mlen := 0
+	for i := 0; i < nibbles; i++ {
+		n := in.bits(4)
+		if i == nibbles-1 && nibbles > 4 && n == 0 {
+			corrupt("invalid meta-block length")
+		}
+		mlen |= n << uint(4*i)
+	}
+	mlen++
+	if !last && in.bits(1) == 1 {
+		in.align()
+		for ; mlen > 0; mlen-- {
+			d.put(in.byte())
+		}
+		d.flush()
+		return false
+	}
+	d.compressed(mlen)
+	d.flush()
+	return last
+}
+
+func (d *decoder) compressed(mlen int) {
+	in := &d.in
+	lit, cmd, dst := in.blocks(), in.blocks(), in.blocks()
+	postfix := uint(in.bits(2))
+	direct := in.bits(4) << postfix
+	modes := make([]int, lit.n)
+	for i := range modes {
+		modes[i] = in.bits(2)
+	}
+	litTrees := make([]*huffman, in.varLen())
+	litMap := in.contextMap(64*lit.n, len(litTrees))
+	distTrees := make([]*huffman, in.varLen())
+	distMap := in.contextMap(4*dst.n, len(distTrees))
+	for i := range litTrees {
+		litTrees[i] = in.prefixCode(256)
+	}
+	cmdTrees := make([]*huffman, cmd.n)
+	for i := range cmdTrees {
+		cmdTrees[i] = in.prefixCode(704)
+	}
+	for i := range distTrees {
+		distTrees[i] = in.prefixCode(16 + direct + 48<<postfix)
+	}
+
+	for mlen > 0 {
+		in.next(cmd)
+		c := in.symbol(cmdTrees[cmd.typ])
+		ic := cellInsert[c>>6] + c>>3&7
+		cc := cellCopy[c>>6] + c&7
+		insert := insertBase[ic] + in.bits(insertExtra[ic])
+		length := copyBase[cc] + in.bits(copyExtra[cc])
+
+		if insert > mlen {
+			corrupt("insert beyond meta-block")
+		}
+		mlen -= insert
+		for ; insert > 0; insert-- {
+			in.next(lit)
+			p1, p2 := d.prevByte(1), d.prevByte(2)
+			var ctx int
+			switch modes[lit.typ] {
+			case 0:
+				ctx = int(p1 & 0x3f)
+			case 1:
+				ctx = int(p1 >> 2)
+			case 2:
+				ctx = int(lut0[p1] | lut1[p2])
+			default:
+				ctx = int(lut2[p1]<<3 | lut2[p2])
+			}
+			d.put(byte(in.symbol(litTrees[litMap[lit.typ<<6+ctx]])))
+		}
+		if mlen == 0 {
+			break
+		}
+
+		code := 0
+		if c >= 128 {
+			in.next(dst)
+			ctx := length - 2
+			if ctx > 3 {
+				ctx = 3
+			}
+			code = in.symbol(distTrees[distMap[dst.typ<<2+ctx]])
+		}
+		dist := d.distance(code, postfix, direct)
+		maxDist := d.maxWin - 16
+		if d.pos < maxDist {
+			maxDist = d.pos
+		}
+		if dist > maxDist {
+			n := d.word(dist-maxDist-1, length)
+			if n > mlen {
+				corrupt("dictionary word beyond meta-block")
+			}
+			mlen -= n
+			continue
+		}
+		if code != 0 {
+			d.dist = [4]int{dist, d.dist[0], d.dist[1], d.dist[2]}
+		}
+		if length > mlen {
+			corrupt("copy beyond meta-block")
+		}
+		mlen -= length
+		for ; length > 0; length-- {
+			d.put(d.win[(d.pos-dist)&(len(d.win)-1)])
+		}
+	}
+}
+
+// prevByte returns the byte output n bytes ago, zero before the start.
+func (d *decoder) prevByte(n int) byte {
+	if d.pos < n {
+		return 0
+	}
+	return d.win[(d.pos-n)&(len(d.win)-1)]
+}
+
+// distance turns a distance code into a distance.
+func (d *decoder) distance(code int, postfix uint, direct int) int {
+	in := &d.in
+	switch {
+	case code < 4:
+		return d.dist[code]
+	case code < 16:
+		delta := [6]int{-1, 1, -2, 2, -3, 3}[(code-4)%6]
+		dist := d.dist[(code-4)/6] + delta
+		if dist <= 0 {
+			corrupt("invalid distance")
+		}
+		return dist
+	case code < 16+direct:
+		return code - 15
+	}
+	code -= 16 + direct
+	nbits := uint(1 + code>>(postfix+1))
+	offset := (2+(code>>postfix)&1)<<nbits - 4
+	return (offset+in.bits(nbits))<<postfix + code&(1<<postfix-1) + direct + 1
+}
+
+// word outputs the static dictionary word with the given id and length,
+// transformed, and returns the number of bytes written.
+func (d *decoder) word(id, length int) int {
+	if length < 4 || length > 24 {
+		corrupt("invalid dictionary word length %d", length)
+	}
+	bits := uint(sizeBits[length])
+	t := id >> bits
+	if t >= len(transforms) {
+		corrupt("invalid dictionary transform %d", t)
+	}
+	off := offsets[length] + (id&(1<<bits-1))*length
+	out := transforms[t].apply(dictionary[off : off+length])
+	for _, b := range out {
+		d.put(b)
+	}
+	return len(out)
+}
@@ -0,0 +1,92 @@
+package brotli
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func decode(data []byte) ([]byte, error) {
+	return io.ReadAll(NewReader(bytes.NewReader(data)))
+}
+
+// The testdata streams were compressed with the reference encoder. Text at
+// quality 11 uses the static dictionary and context modeling, at quality 1
+// with a 1 KiB window the encoder's fast paths, and the random half of
+// mixed ends up in uncompressed meta-blocks.
+func TestReader(t *testing.T) {
+	for stream, plain := range map[string]string{
+		"text.q11.br": "text.txt",
+		"text.q1.br":  "text.txt",
+		"mixed.q5.br": "mixed.bin",
+	} {
+		compressed, err := os.ReadFile("testdata/" + stream)
+		require.NoError(t, err)
+		want, err := os.ReadFile("testdata/" + plain)
+		require.NoError(t, err)
+		got, err := decode(compressed)
+		require.NoError(t, err, stream)
+		require.Equal(t, want, got, stream)
+	}
+}
+
+func TestReaderEmpty(t *testing.T) {
+	got, err := decode([]byte{0x06})
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
+
+func TestReaderTruncated(t *testing.T) {
+	compressed, err := os.ReadFile("testdata/text.q11.br")
+	require.NoError(t, err)
+	_, err = decode(compressed[:len(compressed)/2])
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestReaderCorrupt(t *testing.T) {
+	// Large window streams are not RFC 7932 brotli.
+	_, err := decode([]byte{0x11, 0x06})
+	require.ErrorIs(t, err, ErrCorrupt)
+}
+
+func TestReaderClose(t *testing.T) {
+	compressed, err := os.ReadFile("testdata/mixed.q5.br")
+	require.NoError(t, err)
+	r := NewReader(bytes.NewReader(compressed))
+	_, err = r.Read(make([]byte, 10))
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	_, err = r.Read(make([]byte, 10))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+func FuzzReader(f *testing.F) {
+	for _, name := range []string{"text.q11.br", "text.q1.br", "mixed.q5.br"} {
+		data, err := os.ReadFile("testdata/" + name)
+		require.NoError(f, err)
+		f.Add(data[:len(data)/4])
+	}
+	f.Add([]byte{0x06})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Corrupt streams are fine; runtime errors, even recovered, are not.
+		_, err := io.Copy(io.Discard, io.LimitReader(NewReader(bytes.NewReader(data)), 1<<20))
+		var re runtime.Error
+		if errors.As(err, &re) {
+			t.Fatal(err)
+		}
+	})
+}
+
+// The fuzz corpus in testdata/fuzz/FuzzReader holds the stream that found
+// this: upper-casing a dictionary word cut in the middle of a character.
+func TestFermentShortCharacter(t *testing.T) {
+	w := []byte{0xe3, 0x81}
+	require.Equal(t, 2, ferment(w))
+	require.Equal(t, 1, ferment(w[1:]))
+	require.Equal(t, []byte("ABC\xc3"), transform{typ: uppercaseAll}.apply([]byte("abc\xc3")))
+}
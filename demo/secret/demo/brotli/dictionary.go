@@ -0,0 +1,107 @@
+package brotli
+
+import _ "embed"
+
+// dictionary is the static dictionary of RFC 7932 appendix A.
+//
+//go:embed dictionary.bin
+var dictionary []byte
+
+// sizeBits holds the base 2 logarithm of the number of dictionary words of
+// each length.
+var sizeBits = [25]uint8{0, 0, 0, 0, 10, 10, 11, 11, 10, 10, 10, 10, 10, 9, 9, 8, 7, 7, 8, 7, 7, 6, 6, 5, 5}
+
+// offsets holds where the words of each length start in dictionary.
+var offsets = func() [25]int {
+	var offs [25]int
+	for l := 4; l < len(offs)-1; l++ {
+		offs[l+1] = offs[l] + l<<sizeBits[l]
+	}
+	return offs
+}()
+
+type transformType int
+
+const (
+	identity transformType = iota
+	omitLast1
+	omitLast2
+	omitLast3
+	omitLast4
+	omitLast5
+	omitLast6
+	omitLast7
+	omitLast8
+	omitLast9
+	uppercaseFirst
+	uppercaseAll
+	omitFirst1
+	omitFirst2
+	omitFirst3
+	omitFirst4
+	omitFirst5
+	omitFirst6
+	omitFirst7
+	omitFirst8
+	omitFirst9
+)
+
+// transform turns a dictionary word into the bytes a reference outputs.
+type transform struct {
+	prefix string
+	typ    transformType
+	suffix string
+}
+
+func (t transform) apply(word []byte) []byte {
+	switch {
+	case t.typ >= omitFirst1:
+		n := int(t.typ-omitFirst1) + 1
+		if n > len(word) {
+			n = len(word)
+		}
+		word = word[n:]
+	case t.typ >= omitLast1 && t.typ <= omitLast9:
+		n := int(t.typ-omitLast1) + 1
+		if n > len(word) {
+			n = len(word)
+		}
+		word = word[:len(word)-n]
+	}
+	out := make([]byte, 0, len(t.prefix)+len(word)+len(t.suffix))
+	out = append(out, t.prefix...)
+	start := len(out)
+	out = append(out, word...)
+	switch t.typ {
+	case uppercaseFirst:
+		ferment(out[start:])
+	case uppercaseAll:
+		for w := out[start:]; len(w) > 0; {
+			w = w[ferment(w):]
+		}
+	}
+	return append(out, t.suffix...)
+}
+
+// ferment upper-cases the character w starts with the way RFC 7932 does,
+// returning its length, which is cut short at the end of w.
+func ferment(w []byte) int {
+	switch {
+	case w[0] < 0xc0:
+		if w[0] >= 'a' && w[0] <= 'z' {
+			w[0] ^= 32
+		}
+		return 1
+	case w[0] < 0xe0:
+		if len(w) > 1 {
+			w[1] ^= 32
+			return 2
+		}
+	default:
+		if len(w) > 2 {
+			w[2] ^= 5
+			return 3
+		}
+	}
+	return len(w)
+}
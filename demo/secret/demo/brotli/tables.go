@@ -0,0 +1,187 @@
+package brotli
+
+// Context lookup tables of RFC 7932 section 7.1.
+
+// lut0 and lut1 give the UTF8 context of the last and second to last byte.
+var lut0 = [256]byte{
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 4, 4, 0, 0, 4, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	8, 12, 16, 12, 12, 20, 12, 16, 24, 28, 12, 12, 32, 12, 36, 12,
+	44, 44, 44, 44, 44, 44, 44, 44, 44, 44, 32, 32, 24, 40, 28, 12,
+	12, 48, 52, 52, 52, 48, 52, 52, 52, 48, 52, 52, 52, 52, 52, 48,
+	52, 52, 52, 52, 52, 48, 52, 52, 52, 52, 52, 24, 12, 28, 12, 12,
+	12, 56, 60, 60, 60, 56, 60, 60, 60, 56, 60, 60, 60, 60, 60, 56,
+	60, 60, 60, 60, 60, 56, 60, 60, 60, 60, 60, 24, 12, 28, 12, 0,
+	0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1,
+	0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1,
+	0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1,
+	0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1,
+	2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3,
+	2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3,
+	2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3,
+	2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3,
+}
+
+var lut1 = [256]byte{
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1,
+	1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1,
+	1, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 1, 1, 1, 1, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+}
+
+// lut2 gives the signed context of a byte.
+var lut2 = [256]byte{
+	0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+	4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+	4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+	4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+	5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5,
+	5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5,
+	5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5,
+	6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 7,
+}
+
+// transforms are the word transforms of RFC 7932 appendix B.
+var transforms = [...]transform{
+	{"", identity, ""},
+	{"", identity, " "},
+	{" ", identity, " "},
+	{"", omitFirst1, ""},
+	{"", uppercaseFirst, " "},
+	{"", identity, " the "},
+	{" ", identity, ""},
+	{"s ", identity, " "},
+	{"", identity, " of "},
+	{"", uppercaseFirst, ""},
+	{"", identity, " and "},
+	{"", omitFirst2, ""},
+	{"", omitLast1, ""},
+	{", ", identity, " "},
+	{"", identity, ", "},
+	{" ", uppercaseFirst, " "},
+	{"", identity, " in "},
+	{"", identity, " to "},
+	{"e ", identity, " "},
+	{"", identity, "\""},
+	{"", identity, "."},
+	{"", identity, "\">"},
+	{"", identity, "\n"},
+	{"", omitLast3, ""},
+	{"", identity, "]"},
+	{"", identity, " for "},
+	{"", omitFirst3, ""},
+	{"", omitLast2, ""},
+	{"", identity, " a "},
+	{"", identity, " that "},
+	{" ", uppercaseFirst, ""},
+	{"", identity, ". "},
+	{".", identity, ""},
+	{" ", identity, ", "},
+	{"", omitFirst4, ""},
+	{"", identity, " with "},
+	{"", identity, "'"},
+	{"", identity, " from "},
+	{"", identity, " by "},
+	{"", omitFirst5, ""},
+	{"", omitFirst6, ""},
+	{" the ", identity, ""},
+	{"", omitLast4, ""},
+	{"", identity, ". The "},
+	{"", uppercaseAll, ""},
+	{"", identity, " on "},
+	{"", identity, " as "},
+	{"", identity, " is "},
+	{"", omitLast7, ""},
+	{"", omitLast1, "ing "},
+	{"", identity, "\n\t"},
+	{"", identity, ":"},
+	{" ", identity, ". "},
+	{"", identity, "ed "},
+	{"", omitFirst9, ""},
+	{"", omitFirst7, ""},
+	{"", omitLast6, ""},
+	{"", identity, "("},
+	{"", uppercaseFirst, ", "},
+	{"", omitLast8, ""},
+	{"", identity, " at "},
+	{"", identity, "ly "},
+	{" the ", identity, " of "},
+	{"", omitLast5, ""},
+	{"", omitLast9, ""},
+	{" ", uppercaseFirst, ", "},
+	{"", uppercaseFirst, "\""},
+	{".", identity, "("},
+	{"", uppercaseAll, " "},
+	{"", uppercaseFirst, "\">"},
+	{"", identity, "=\""},
+	{" ", identity, "."},
+	{".com/", identity, ""},
+	{" the ", identity, " of the "},
+	{"", uppercaseFirst, "'"},
+	{"", identity, ". This "},
+	{"", identity, ","},
+	{".", identity, " "},
+	{"", uppercaseFirst, "("},
+	{"", uppercaseFirst, "."},
+	{"", identity, " not "},
+	{" ", identity, "=\""},
+	{"", identity, "er "},
+	{" ", uppercaseAll, " "},
+	{"", identity, "al "},
+	{" ", uppercaseAll, ""},
+	{"", identity, "='"},
+	{"", uppercaseAll, "\""},
+	{"", uppercaseFirst, ". "},
+	{" ", identity, "("},
+	{"", identity, "ful "},
+	{" ", uppercaseFirst, ". "},
+	{"", identity, "ive "},
+	{"", identity, "less "},
+	{"", uppercaseAll, "'"},
+	{"", identity, "est "},
+	{" ", uppercaseFirst, "."},
+	{"", uppercaseAll, "\">"},
+	{" ", identity, "='"},
+	{"", uppercaseFirst, ","},
+	{"", identity, "ize "},
+	{"", uppercaseAll, "."},
+	{"\xc2\xa0", identity, ""},
+	{" ", identity, ","},
+	{"", uppercaseFirst, "=\""},
+	{"", uppercaseAll, "=\""},
+	{"", identity, "ous "},
+	{"", uppercaseAll, ", "},
+	{"", uppercaseFirst, "='"},
+	{" ", uppercaseFirst, ","},
+	{" ", uppercaseAll, "=\""},
+	{" ", uppercaseAll, ", "},
+	{"", uppercaseAll, ","},
+	{"", uppercaseAll, "("},
+	{"", uppercaseAll, ". "},
+	{" ", uppercaseAll, "."},
+	{"", uppercaseAll, "='"},
+	{" ", uppercaseAll, ". "},
+	{" ", uppercaseFirst, "=\""},
+	{" ", uppercaseAll, "='"},
+	{" ", uppercaseFirst, "='"},
+}
@@ -0,0 +1,252 @@
+// Package ca is a minimal certificate authority for the local PSE stand-ins.
+package ca
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authority signs leaf certificates.
+type Authority struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// New creates a self-signed CA valid for ten years.
+func New(name string) (*Authority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial(),
+		Subject:               pkix.Name{CommonName: name, Organization: []string{"PSE"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Authority{Cert: cert, Key: key}, nil
+}
+
+// CertPEM returns the PEM encoded CA certificate, as served on /ca.
+func (a *Authority) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.Cert.Raw})
+}
+
+// KeyPEM returns the PEM encoded CA private key.
+func (a *Authority) KeyPEM() ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(a.Key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// LoadOrCreate reads the CA from certFile and keyFile, creating and saving a
+// new one if they do not exist yet. A key without its certificate is left
+// alone rather than replaced.
+func LoadOrCreate(name, certFile, keyFile string) (*Authority, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(keyFile); !errors.Is(err, os.ErrNotExist) {
+			if err != nil {
+				return nil, err
+			}
+			return nil, errors.New("ca: " + keyFile + " exists without " + certFile + ", refusing to replace the key")
+		}
+		a, err := New(name)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, err := a.KeyPEM()
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+			return nil, err
+		}
+		return a, os.WriteFile(certFile, a.CertPEM(), 0o644)
+	}
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok || !cert.IsCA {
+		return nil, errors.New("ca: " + certFile + " is not an ECDSA CA certificate")
+	}
+	return &Authority{Cert: cert, Key: key}, nil
+}
+
+// Leaf issues a server certificate for the given host names and addresses.
+func (a *Authority) Leaf(hosts ...string) (*tls.Certificate, error) {
+	if len(hosts) == 0 {
+		return nil, errors.New("ca: a certificate needs at least one host")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial(),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.Cert, &key.PublicKey, a.Key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, a.Cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+func serial() *big.Int {
+	n, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// DefaultCacheSize is the number of certificates a Cache keeps by default.
+const DefaultCacheSize = 1024
+
+// Cache mints leaf certificates on demand for the server name a TLS client
+// asks for, reusing them for later connections. Names are minted
+// concurrently; clients asking for the same name wait for one certificate.
+// The least recently used certificates are dropped beyond Size.
+type Cache struct {
+	CA *Authority
+	// Size defaults to DefaultCacheSize.
+	Size int
+
+	mu    sync.Mutex
+	certs map[string]*leaf
+	// lru orders the leaves, most recently used first.
+	lru list.List
+}
+
+// leaf is a certificate being minted; ready is closed once cert or err is
+// set.
+type leaf struct {
+	ready chan struct{}
+	cert  *tls.Certificate
+	err   error
+
+	name string
+	elem *list.Element
+}
+
+// expired reports whether l was minted and is no longer valid.
+func (l *leaf) expired() bool {
+	select {
+	case <-l.ready:
+		return l.err == nil && !time.Now().Before(l.cert.Leaf.NotAfter)
+	default:
+		return false
+	}
+}
+
+// GetCertificate is suitable for tls.Config.GetCertificate.
+func (c *Cache) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name == "" {
+		return nil, errors.New("ca: client sent no server name")
+	}
+
+	c.mu.Lock()
+	l := c.certs[name]
+	if l != nil && !l.expired() {
+		c.lru.MoveToFront(l.elem)
+		c.mu.Unlock()
+		<-l.ready
+		return l.cert, l.err
+	}
+	if l != nil {
+		c.remove(l)
+	}
+	l = &leaf{ready: make(chan struct{}), name: name}
+	if c.certs == nil {
+		c.certs = map[string]*leaf{}
+	}
+	c.certs[name] = l
+	l.elem = c.lru.PushFront(l)
+	size := c.Size
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	for c.lru.Len() > size {
+		// Clients waiting on an evicted leaf still get its certificate.
+		c.remove(c.lru.Back().Value.(*leaf))
+	}
+	c.mu.Unlock()
+
+	l.cert, l.err = c.CA.Leaf(name)
+	close(l.ready)
+	if l.err != nil {
+		// Let the next client try again.
+		c.mu.Lock()
+		if c.certs[name] == l {
+			c.remove(l)
+		}
+		c.mu.Unlock()
+	}
+	return l.cert, l.err
+}
+
+// remove drops l from the cache; c.mu must be held.
+func (c *Cache) remove(l *leaf) {
+	delete(c.certs, l.name)
+	c.lru.Remove(l.elem)
+}
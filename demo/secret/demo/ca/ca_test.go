@@ -0,0 +1,101 @@
+package ca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeafVerifies(t *testing.T) {
+	a, err := New("PSE Test CA")
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(a.CertPEM()))
+
+	leaf, err := a.Leaf("pse.invisirisk.com", "127.0.0.1")
+	require.NoError(t, err)
+	_, err = leaf.Leaf.Verify(x509.VerifyOptions{DNSName: "pse.invisirisk.com", Roots: pool})
+	require.NoError(t, err)
+	_, err = leaf.Leaf.Verify(x509.VerifyOptions{DNSName: "127.0.0.1", Roots: pool})
+	require.NoError(t, err)
+	_, err = leaf.Leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: pool})
+	require.Error(t, err)
+	_, err = a.Leaf()
+	require.EqualError(t, err, "ca: a certificate needs at least one host")
+}
+
+func TestLoadOrCreate(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	a, err := LoadOrCreate("PSE Test CA", cert, key)
+	require.NoError(t, err)
+	b, err := LoadOrCreate("PSE Test CA", cert, key)
+	require.NoError(t, err)
+	require.Equal(t, a.Cert.Raw, b.Cert.Raw)
+	require.True(t, a.Key.Equal(b.Key))
+}
+
+func TestLoadOrCreateKeepsKey(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	require.NoError(t, os.WriteFile(key, []byte("key"), 0o600))
+	_, err := LoadOrCreate("PSE Test CA", cert, key)
+	require.ErrorContains(t, err, "refusing to replace the key")
+	data, err := os.ReadFile(key)
+	require.NoError(t, err)
+	require.Equal(t, "key", string(data))
+}
+
+func TestCache(t *testing.T) {
+	a, err := New("PSE Test CA")
+	require.NoError(t, err)
+	c := &Cache{CA: a}
+	first, err := c.GetCertificate(&tls.ClientHelloInfo{ServerName: "Example.com."})
+	require.NoError(t, err)
+	require.Equal(t, []string{"example.com"}, first.Leaf.DNSNames)
+	second, err := c.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	require.NoError(t, err)
+	require.Same(t, first, second)
+	_, err = c.GetCertificate(&tls.ClientHelloInfo{})
+	require.Error(t, err)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	a, err := New("PSE Test CA")
+	require.NoError(t, err)
+	c := &Cache{CA: a, Size: 2}
+	get := func(name string) *tls.Certificate {
+		cert, err := c.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+		require.NoError(t, err)
+		return cert
+	}
+	first, second := get("a.example"), get("b.example")
+	require.Same(t, first, get("a.example"))
+	get("c.example")
+	require.Len(t, c.certs, 2)
+	require.Same(t, first, get("a.example"))
+	require.NotSame(t, second, get("b.example"))
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	a, err := New("PSE Test CA")
+	require.NoError(t, err)
+	c := &Cache{CA: a}
+	certs := make(chan *tls.Certificate, 8)
+	for i := 0; i < cap(certs); i++ {
+		go func() {
+			cert, _ := c.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+			certs <- cert
+		}()
+	}
+	first := <-certs
+	require.NotNil(t, first)
+	for i := 1; i < cap(certs); i++ {
+		require.Same(t, first, <-certs)
+	}
+}
@@ -0,0 +1,206 @@
+// Package ci detects the CI system a build runs on and maps its environment
+// to the build metadata PSE expects.
+package ci
+
+import (
+	"strings"
+
+	"inivisirisk.com/demo/demo/pse"
+)
+
+// Env looks up an environment variable, as os.Getenv does.
+type Env func(string) string
+
+// Builder describes one CI system.
+type Builder struct {
+	// Name is sent as the builder field of /start.
+	Name string
+	// Detect reports whether the build runs on this CI system.
+	Detect func(env Env) bool
+	// Info returns the /start metadata.
+	Info func(env Env) pse.BuildInfo
+	// Status returns the build status for /end, or "" if the CI system
+	// does not expose it.
+	Status func(env Env) string
+}
+
+// Builders lists the supported CI systems in detection order.
+var Builders = []Builder{
+	{Name: "github", Detect: isTrue("GITHUB_ACTIONS"), Info: github, Status: lookup("GITHUB_RUN_RESULT")},
+	{Name: "gitlab", Detect: isTrue("GITLAB_CI"), Info: gitlab, Status: lookup("CI_JOB_STATUS")},
+	{Name: "buildkite", Detect: isTrue("BUILDKITE"), Info: buildkite, Status: buildkiteStatus},
+	{Name: "circleci", Detect: isTrue("CIRCLECI"), Info: circleci, Status: none},
+	{Name: "azure", Detect: isTrue("TF_BUILD"), Info: azure, Status: lookup("AGENT_JOBSTATUS")},
+	{Name: "jenkins", Detect: isSet("JENKINS_URL"), Info: jenkins, Status: none},
+}
+
+// Detect returns the CI system the build runs on.
+func Detect(env Env) (Builder, bool) {
+	for _, b := range Builders {
+		if b.Detect(env) {
+			return b, true
+		}
+	}
+	return Builder{}, false
+}
+
+// Lookup returns the CI system with the given name.
+func Lookup(name string) (Builder, bool) {
+	for _, b := range Builders {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return Builder{}, false
+}
+
+// Names returns the names of all supported CI systems.
+func Names() []string {
+	names := make([]string, len(Builders))
+	for i, b := range Builders {
+		names[i] = b.Name
+	}
+	return names
+}
+
+func isTrue(name string) func(Env) bool {
+	return func(env Env) bool { return strings.EqualFold(env(name), "true") }
+}
+
+func isSet(name string) func(Env) bool {
+	return func(env Env) bool { return env(name) != "" }
+}
+
+func lookup(name string) func(Env) string {
+	return func(env Env) string { return env(name) }
+}
+
+func none(Env) string { return "" }
+
+// join joins the non-empty parts with sep.
+func join(sep string, parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, sep)
+}
+
+func withSlash(u string) string {
+	if u == "" || strings.HasSuffix(u, "/") {
+		return u
+	}
+	return u + "/"
+}
+
+func github(env Env) pse.BuildInfo {
+	base := withSlash(env("GITHUB_SERVER_URL"))
+	repo := env("GITHUB_REPOSITORY")
+	return pse.BuildInfo{
+		Builder:    "github",
+		BuildID:    env("GITHUB_RUN_ID"),
+		BuildURL:   base + repo + "/actions/runs/" + env("GITHUB_RUN_ID") + "/attempts/" + env("GITHUB_RUN_ATTEMPT"),
+		Project:    repo,
+		Workflow:   env("GITHUB_WORKFLOW") + " - " + env("GITHUB_JOB"),
+		BuilderURL: base,
+		SCM:        "git",
+		SCMCommit:  env("GITHUB_SHA"),
+		SCMBranch:  env("GITHUB_REF_NAME"),
+		SCMOrigin:  base + repo,
+	}
+}
+
+func jenkins(env Env) pse.BuildInfo {
+	branch := env("BRANCH_NAME")
+	if branch == "" {
+		branch = env("GIT_BRANCH")
+	}
+	return pse.BuildInfo{
+		Builder:    "jenkins",
+		BuildID:    env("BUILD_NUMBER"),
+		BuildURL:   env("BUILD_URL"),
+		Project:    env("JOB_NAME"),
+		Workflow:   join(" - ", env("JOB_NAME"), env("STAGE_NAME")),
+		BuilderURL: env("JENKINS_URL"),
+		SCM:        "git",
+		SCMCommit:  env("GIT_COMMIT"),
+		SCMBranch:  branch,
+		SCMOrigin:  env("GIT_URL"),
+	}
+}
+
+func gitlab(env Env) pse.BuildInfo {
+	return pse.BuildInfo{
+		Builder:    "gitlab",
+		BuildID:    env("CI_PIPELINE_ID"),
+		BuildURL:   env("CI_PIPELINE_URL"),
+		Project:    env("CI_PROJECT_PATH"),
+		Workflow:   join(" - ", env("CI_JOB_STAGE"), env("CI_JOB_NAME")),
+		BuilderURL: withSlash(env("CI_SERVER_URL")),
+		SCM:        "git",
+		SCMCommit:  env("CI_COMMIT_SHA"),
+		SCMBranch:  env("CI_COMMIT_REF_NAME"),
+		SCMOrigin:  env("CI_PROJECT_URL"),
+	}
+}
+
+func buildkite(env Env) pse.BuildInfo {
+	return pse.BuildInfo{
+		Builder:    "buildkite",
+		BuildID:    env("BUILDKITE_BUILD_ID"),
+		BuildURL:   env("BUILDKITE_BUILD_URL"),
+		Project:    join("/", env("BUILDKITE_ORGANIZATION_SLUG"), env("BUILDKITE_PIPELINE_SLUG")),
+		Workflow:   join(" - ", env("BUILDKITE_PIPELINE_NAME"), env("BUILDKITE_LABEL")),
+		BuilderURL: "https://buildkite.com/",
+		SCM:        "git",
+		SCMCommit:  env("BUILDKITE_COMMIT"),
+		SCMBranch:  env("BUILDKITE_BRANCH"),
+		SCMOrigin:  env("BUILDKITE_REPO"),
+	}
+}
+
+// buildkiteStatus maps the exit status of the step command, available to
+// post-command hooks.
+func buildkiteStatus(env Env) string {
+	switch env("BUILDKITE_COMMAND_EXIT_STATUS") {
+	case "":
+		return ""
+	case "0":
+		return "success"
+	default:
+		return "failure"
+	}
+}
+
+func circleci(env Env) pse.BuildInfo {
+	return pse.BuildInfo{
+		Builder:    "circleci",
+		BuildID:    env("CIRCLE_BUILD_NUM"),
+		BuildURL:   env("CIRCLE_BUILD_URL"),
+		Project:    join("/", env("CIRCLE_PROJECT_USERNAME"), env("CIRCLE_PROJECT_REPONAME")),
+		Workflow:   join(" - ", env("CIRCLE_WORKFLOW_ID"), env("CIRCLE_JOB")),
+		BuilderURL: "https://app.circleci.com/",
+		SCM:        "git",
+		SCMCommit:  env("CIRCLE_SHA1"),
+		SCMBranch:  env("CIRCLE_BRANCH"),
+		SCMOrigin:  env("CIRCLE_REPOSITORY_URL"),
+	}
+}
+
+func azure(env Env) pse.BuildInfo {
+	collection := withSlash(env("SYSTEM_COLLECTIONURI"))
+	return pse.BuildInfo{
+		Builder:    "azure",
+		BuildID:    env("BUILD_BUILDID"),
+		BuildURL:   collection + env("SYSTEM_TEAMPROJECT") + "/_build/results?buildId=" + env("BUILD_BUILDID"),
+		Project:    env("BUILD_REPOSITORY_NAME"),
+		Workflow:   join(" - ", env("BUILD_DEFINITIONNAME"), env("SYSTEM_JOBDISPLAYNAME")),
+		BuilderURL: collection,
+		SCM:        "git",
+		SCMCommit:  env("BUILD_SOURCEVERSION"),
+		SCMBranch:  env("BUILD_SOURCEBRANCHNAME"),
+		SCMOrigin:  env("BUILD_REPOSITORY_URI"),
+	}
+}
@@ -0,0 +1,137 @@
+package ci
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/pse"
+)
+
+func env(m map[string]string) Env {
+	return func(k string) string { return m[k] }
+}
+
+func TestDetect(t *testing.T) {
+	cases := map[string]map[string]string{
+		"github":    {"GITHUB_ACTIONS": "true"},
+		"gitlab":    {"GITLAB_CI": "true"},
+		"buildkite": {"BUILDKITE": "true"},
+		"circleci":  {"CIRCLECI": "true"},
+		"azure":     {"TF_BUILD": "True"},
+		"jenkins":   {"JENKINS_URL": "https://jenkins.example.com/"},
+	}
+	for name, vars := range cases {
+		b, ok := Detect(env(vars))
+		require.True(t, ok, name)
+		require.Equal(t, name, b.Name)
+	}
+	_, ok := Detect(env(nil))
+	require.False(t, ok)
+}
+
+func TestGitHub(t *testing.T) {
+	b, _ := Lookup("github")
+	e := env(map[string]string{
+		"GITHUB_SERVER_URL":  "https://github.com",
+		"GITHUB_REPOSITORY":  "invisirisk/pse-action",
+		"GITHUB_RUN_ID":      "4840230332",
+		"GITHUB_RUN_ATTEMPT": "1",
+		"GITHUB_WORKFLOW":    "PSE Demo",
+		"GITHUB_JOB":         "npm",
+		"GITHUB_SHA":         "abc123",
+		"GITHUB_REF_NAME":    "main",
+		"GITHUB_RUN_RESULT":  "success",
+	})
+	require.Equal(t, pse.BuildInfo{
+		Builder:    "github",
+		BuildID:    "4840230332",
+		BuildURL:   "https://github.com/invisirisk/pse-action/actions/runs/4840230332/attempts/1",
+		Project:    "invisirisk/pse-action",
+		Workflow:   "PSE Demo - npm",
+		BuilderURL: "https://github.com/",
+		SCM:        "git",
+		SCMCommit:  "abc123",
+		SCMBranch:  "main",
+		SCMOrigin:  "https://github.com/invisirisk/pse-action",
+	}, b.Info(e))
+	require.Equal(t, "success", b.Status(e))
+}
+
+func TestJenkins(t *testing.T) {
+	b, _ := Lookup("jenkins")
+	info := b.Info(env(map[string]string{
+		"JENKINS_URL":  "https://jenkins.example.com/",
+		"BUILD_NUMBER": "17",
+		"BUILD_URL":    "https://jenkins.example.com/job/demo/17/",
+		"JOB_NAME":     "demo",
+		"GIT_COMMIT":   "abc123",
+		"GIT_BRANCH":   "origin/main",
+		"GIT_URL":      "https://github.com/invisirisk/pse-action",
+	}))
+	require.Equal(t, "17", info.BuildID)
+	require.Equal(t, "https://jenkins.example.com/job/demo/17/", info.BuildURL)
+	require.Equal(t, "demo", info.Workflow)
+	require.Equal(t, "origin/main", info.SCMBranch)
+	require.Equal(t, "https://github.com/invisirisk/pse-action", info.SCMOrigin)
+}
+
+func TestGitLab(t *testing.T) {
+	b, _ := Lookup("gitlab")
+	e := env(map[string]string{
+		"CI_PIPELINE_ID":     "99",
+		"CI_PIPELINE_URL":    "https://gitlab.com/g/p/-/pipelines/99",
+		"CI_PROJECT_PATH":    "g/p",
+		"CI_JOB_STAGE":       "build",
+		"CI_JOB_NAME":        "compile",
+		"CI_SERVER_URL":      "https://gitlab.com",
+		"CI_COMMIT_SHA":      "abc123",
+		"CI_COMMIT_REF_NAME": "main",
+		"CI_PROJECT_URL":     "https://gitlab.com/g/p",
+		"CI_JOB_STATUS":      "failed",
+	})
+	info := b.Info(e)
+	require.Equal(t, "https://gitlab.com/g/p/-/pipelines/99", info.BuildURL)
+	require.Equal(t, "build - compile", info.Workflow)
+	require.Equal(t, "https://gitlab.com/", info.BuilderURL)
+	require.Equal(t, "failed", b.Status(e))
+}
+
+func TestBuildkite(t *testing.T) {
+	b, _ := Lookup("buildkite")
+	e := env(map[string]string{
+		"BUILDKITE_ORGANIZATION_SLUG":   "acme",
+		"BUILDKITE_PIPELINE_SLUG":       "app",
+		"BUILDKITE_BUILD_URL":           "https://buildkite.com/acme/app/builds/5",
+		"BUILDKITE_COMMAND_EXIT_STATUS": "2",
+	})
+	require.Equal(t, "acme/app", b.Info(e).Project)
+	require.Equal(t, "https://buildkite.com/acme/app/builds/5", b.Info(e).BuildURL)
+	require.Equal(t, "failure", b.Status(e))
+}
+
+func TestCircleCI(t *testing.T) {
+	b, _ := Lookup("circleci")
+	info := b.Info(env(map[string]string{
+		"CIRCLE_BUILD_NUM":        "8",
+		"CIRCLE_BUILD_URL":        "https://circleci.com/gh/acme/app/8",
+		"CIRCLE_PROJECT_USERNAME": "acme",
+		"CIRCLE_PROJECT_REPONAME": "app",
+		"CIRCLE_JOB":              "test",
+		"CIRCLE_SHA1":             "abc123",
+	}))
+	require.Equal(t, "acme/app", info.Project)
+	require.Equal(t, "test", info.Workflow)
+	require.Equal(t, "abc123", info.SCMCommit)
+}
+
+func TestAzure(t *testing.T) {
+	b, _ := Lookup("azure")
+	e := env(map[string]string{
+		"SYSTEM_COLLECTIONURI": "https://dev.azure.com/acme/",
+		"SYSTEM_TEAMPROJECT":   "app",
+		"BUILD_BUILDID":        "31",
+		"AGENT_JOBSTATUS":      "Succeeded",
+	})
+	require.Equal(t, "https://dev.azure.com/acme/app/_build/results?buildId=31", b.Info(e).BuildURL)
+	require.Equal(t, "Succeeded", b.Status(e))
+}
@@ -0,0 +1,104 @@
+// Package classify turns intercepted HTTP requests into PSE events by
+// recognizing the protocols builds speak: module proxies, package
+// registries, git and plain web traffic.
+package classify
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"inivisirisk.com/demo/demo/event"
+)
+
+// Classifier recognizes one protocol.
+type Classifier interface {
+	// Classify returns the event r represents, or nil if r is not part of
+	// the protocol.
+	Classify(r *http.Request) *event.Event
+}
+
+// Chain tries each classifier in turn.
+type Chain []Classifier
+
+// Classify implements Classifier.
+func (c Chain) Classify(r *http.Request) *event.Event {
+	for _, cl := range c {
+		if e := cl.Classify(r); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// Web classifies any request as a web event.
+type Web struct{}
+
+// Classify implements Classifier.
+func (Web) Classify(r *http.Request) *event.Event {
+	return event.New(strings.ToLower(r.Method), &event.WebDetails{
+		URL:  requestURL(r),
+		Host: host(r),
+		Path: r.URL.Path,
+	})
+}
+
+// Default returns the classifiers for the public registries, falling back
+// to web events.
+func Default() Chain {
+	return Chain{
+		&GoProxy{},
+		&NPM{},
+		&Maven{},
+		&PyPI{},
+		Git{},
+		OCI{},
+		Web{},
+	}
+}
+
+// host returns the lower case name of the host r was sent to, without a
+// port, so that proxy.golang.org:443 matches like proxy.golang.org.
+func host(r *http.Request) string {
+	h := hostPort(r)
+	if name, _, err := net.SplitHostPort(h); err == nil {
+		h = name
+	}
+	return strings.TrimSuffix(h, ".")
+}
+
+func hostPort(r *http.Request) string {
+	h := r.Host
+	if h == "" {
+		h = r.URL.Host
+	}
+	return strings.ToLower(h)
+}
+
+func requestURL(r *http.Request) string {
+	return origin(r) + r.URL.RequestURI()
+}
+
+// origin returns the scheme and host r was sent to, keeping the port.
+func origin(r *http.Request) string {
+	if r.TLS == nil {
+		return "http://" + hostPort(r)
+	}
+	return "https://" + hostPort(r)
+}
+
+// trimBase strips the path of the first base URL on host from the escaped
+// path p.
+func trimBase(bases []string, host, p string) (string, bool) {
+	for _, base := range bases {
+		u, err := url.Parse(base)
+		if err != nil || !strings.EqualFold(u.Hostname(), host) {
+			continue
+		}
+		if rest, ok := cutPrefix(p, strings.TrimRight(u.EscapedPath(), "/")); ok && (rest == "" || rest[0] == '/') {
+			return rest, true
+		}
+	}
+	return p, false
+}
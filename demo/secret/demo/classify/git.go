@@ -0,0 +1,166 @@
+package classify
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"inivisirisk.com/demo/demo/event"
+	"inivisirisk.com/demo/demo/secrets"
+)
+
+// maxGitBody bounds how much of an upload-pack or receive-pack request is
+// buffered for classification; the rest is streamed untouched.
+const maxGitBody = 16 << 20
+
+// zeroID is the object id git uses for a missing ref.
+const zeroID = "0000000000000000000000000000000000000000"
+
+// Git classifies git smart HTTP requests on any host. Fetches are pull
+// events and pushes push events; the operation distinguishes clone, fetch,
+// push and ref advertisements.
+//
+// Whether a push is forced cannot be known without the repository, so Force
+// is a heuristic: a ref update is treated as forced unless its old commit is
+// reachable from its new one through the commits in the pushed pack. A
+// fast-forward onto commits the server already had on another ref is
+// therefore reported as forced too.
+type Git struct{}
+
+// Classify implements Classifier. It reads the start of POST bodies,
+// leaving r.Body to yield the whole body again.
+func (Git) Classify(r *http.Request) *event.Event {
+	p := r.URL.Path
+	var repo, service string
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(p, "/info/refs"):
+		repo, service = strings.TrimSuffix(p, "/info/refs"), r.URL.Query().Get("service")
+	case r.Method == http.MethodPost && strings.HasSuffix(p, "/git-upload-pack"):
+		repo, service = strings.TrimSuffix(p, "/git-upload-pack"), "git-upload-pack"
+	case r.Method == http.MethodPost && strings.HasSuffix(p, "/git-receive-pack"):
+		repo, service = strings.TrimSuffix(p, "/git-receive-pack"), "git-receive-pack"
+	default:
+		return nil
+	}
+	if repo == "" {
+		return nil
+	}
+	action := "pull"
+	switch service {
+	case "git-upload-pack":
+	case "git-receive-pack":
+		action = "push"
+	default:
+		return nil
+	}
+	d := &event.GitDetails{
+		Repo: host(r) + strings.TrimSuffix(repo, ".git"),
+		URL:  origin(r) + repo,
+	}
+	if r.Method == http.MethodGet {
+		d.Operation = "refs"
+		return event.New(action, d)
+	}
+
+	body := peekBody(r)
+	if action == "push" {
+		d.Operation = "push"
+		d.Refs, d.Force = parsePush(body)
+		return event.New(action, d)
+	}
+	d.Operation = parseUploadPack(body)
+	return event.New(action, d)
+}
+
+// peekBody returns up to maxGitBody bytes of the decoded request body and
+// restores r.Body.
+func peekBody(r *http.Request) []byte {
+	if r.Body == nil {
+		return nil
+	}
+	head, _ := io.ReadAll(io.LimitReader(r.Body, maxGitBody))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+
+	enc := r.Header.Get("Content-Encoding")
+	if enc == "" {
+		return head
+	}
+	zr, err := secrets.Decompress(bytes.NewReader(head), enc)
+	if err != nil {
+		return nil
+	}
+	defer zr.Close()
+	// A truncated body still yields the commands at its start.
+	body, _ := io.ReadAll(io.LimitReader(zr, maxGitBody))
+	return body
+}
+
+// parseUploadPack tells a clone, which has nothing to negotiate, from a
+// fetch, which sends haves. A protocol v2 ls-refs command is a ref
+// advertisement.
+func parseUploadPack(body []byte) string {
+	op := "clone"
+	for _, line := range pktLines(body) {
+		switch {
+		case line == "command=ls-refs":
+			return "refs"
+		case strings.HasPrefix(line, "have "):
+			op = "fetch"
+		}
+	}
+	return op
+}
+
+// parsePush returns the ref updates of a receive-pack request and whether
+// any may be forced.
+func parsePush(body []byte) ([]event.RefUpdate, bool) {
+	var refs []event.RefUpdate
+	lines, rest := pktCommands(body)
+	for _, line := range lines {
+		line, _, _ = strings.Cut(line, "\x00")
+		f := strings.Fields(line)
+		if len(f) != 3 || len(f[0]) != len(zeroID) || len(f[1]) != len(zeroID) {
+			continue
+		}
+		refs = append(refs, event.RefUpdate{Old: f[0], New: f[1], Ref: f[2]})
+	}
+
+	var parents map[string][]string
+	force := false
+	for i, u := range refs {
+		if u.Old == zeroID || u.New == zeroID {
+			continue
+		}
+		if parents == nil {
+			parents = packCommits(rest)
+		}
+		if !reachable(parents, u.New, u.Old) {
+			refs[i].Force = true
+			force = true
+		}
+	}
+	return refs, force
+}
+
+// reachable reports whether to is from or an ancestor of it in parents.
+func reachable(parents map[string][]string, from, to string) bool {
+	seen := map[string]bool{}
+	queue := []string{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == to {
+			return true
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		queue = append(queue, parents[id]...)
+	}
+	return false
+}
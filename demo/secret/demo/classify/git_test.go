@@ -0,0 +1,189 @@
+package classify
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/event"
+)
+
+func pkt(lines ...string) string {
+	var b strings.Builder
+	for _, l := range lines {
+		if l == "" {
+			b.WriteString("0000")
+			continue
+		}
+		fmt.Fprintf(&b, "%04x%s", len(l)+4, l)
+	}
+	return b.String()
+}
+
+type object struct {
+	typ  int
+	data []byte
+}
+
+func commit(parents ...string) object {
+	var b strings.Builder
+	b.WriteString("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n")
+	for _, p := range parents {
+		b.WriteString("parent " + p + "\n")
+	}
+	b.WriteString("author PSE <pse@invisirisk.com> 1682856000 +0000\ncommitter PSE <pse@invisirisk.com> 1682856000 +0000\n\nbuild\n")
+	return object{objCommit, []byte(b.String())}
+}
+
+func (o object) id() string {
+	sum := sha1.Sum(append([]byte(fmt.Sprintf("commit %d\x00", len(o.data))), o.data...))
+	return hex.EncodeToString(sum[:])
+}
+
+func pack(objects ...object) string {
+	var b bytes.Buffer
+	b.WriteString("PACK")
+	binary.Write(&b, binary.BigEndian, uint32(2))
+	binary.Write(&b, binary.BigEndian, uint32(len(objects)))
+	for _, o := range objects {
+		size := len(o.data)
+		c := byte(o.typ<<4 | size&15)
+		size >>= 4
+		for size > 0 {
+			b.WriteByte(c | 0x80)
+			c, size = byte(size&0x7f), size>>7
+		}
+		b.WriteByte(c)
+		if o.typ == objOfsDelta {
+			b.WriteByte(0x81)
+			b.WriteByte(0x05)
+		}
+		zw := zlib.NewWriter(&b)
+		zw.Write(o.data)
+		zw.Close()
+	}
+	return b.String()
+}
+
+func TestCommitID(t *testing.T) {
+	// git hash-object -t commit of the same content.
+	require.Equal(t, "2c3683af498ac53c4cfd68d7de736721dae4c1ee", commit().id())
+}
+
+func TestGitRefs(t *testing.T) {
+	e := Default().Classify(httptest.NewRequest("GET", "https://github.com/TheTorProject/gettorbrowser.git/info/refs?service=git-upload-pack", nil))
+	require.Equal(t, "git - pull - github.com/TheTorProject/gettorbrowser", e.Title())
+	require.Equal(t, &event.GitDetails{
+		Repo:      "github.com/TheTorProject/gettorbrowser",
+		URL:       "https://github.com/TheTorProject/gettorbrowser.git",
+		Operation: "refs",
+	}, e.Details)
+
+	e = Git{}.Classify(httptest.NewRequest("GET", "https://github.com/invisirisk-demo/app/info/refs?service=git-receive-pack", nil))
+	require.Equal(t, "push", e.Action)
+	require.Equal(t, "github.com/invisirisk-demo/app", e.Details.(*event.GitDetails).Repo)
+
+	e = Git{}.Classify(httptest.NewRequest("GET", "http://git.corp.example/app.git/info/refs?service=git-upload-pack", nil))
+	require.Equal(t, "http://git.corp.example/app.git", e.Details.(*event.GitDetails).URL)
+
+	require.Nil(t, Git{}.Classify(httptest.NewRequest("GET", "https://github.com/a/b/info/refs", nil)))
+	require.Nil(t, Git{}.Classify(httptest.NewRequest("GET", "https://github.com/a/b/git-upload-pack", nil)))
+}
+
+func TestGitUploadPack(t *testing.T) {
+	want := "want 5f4d5ee56a20b5d8e5cb1de1fb5e2b3ef9a12dbd multi_ack_detailed side-band-64k ofs-delta\n"
+	have := "have 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n"
+	cases := []struct {
+		body string
+		op   string
+	}{
+		{pkt(want, "", "done\n"), "clone"},
+		{pkt(want, "", have, "done\n"), "fetch"},
+		{pkt("command=fetch\n", "agent=git/2.40.0\n") + "0001" + pkt(want, have, "done\n", ""), "fetch"},
+		{pkt("command=ls-refs\n") + "0001" + pkt("peel\n", "ref-prefix HEAD\n", ""), "refs"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", "https://github.com/TheTorProject/gettorbrowser.git/git-upload-pack", strings.NewReader(c.body))
+		e := Git{}.Classify(r)
+		require.Equal(t, "pull", e.Action)
+		require.Equal(t, c.op, e.Details.(*event.GitDetails).Operation, c.body)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, c.body, string(body))
+	}
+}
+
+func TestGitUploadPackGzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(pkt("want 5f4d5ee56a20b5d8e5cb1de1fb5e2b3ef9a12dbd\n", "", "have 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n", "done\n")))
+	zw.Close()
+	r := httptest.NewRequest("POST", "https://github.com/a/b/git-upload-pack", bytes.NewReader(buf.Bytes()))
+	r.Header.Set("Content-Encoding", "gzip")
+	require.Equal(t, "fetch", Git{}.Classify(r).Details.(*event.GitDetails).Operation)
+}
+
+func TestGitPush(t *testing.T) {
+	base := commit()
+	next := commit(base.id())
+	rewritten := commit("4b825dc642cb6eb9a060e54bf8d69288fbee4904")
+	blob := object{3, []byte("hello\n")}
+	delta := object{objOfsDelta, []byte("delta")}
+
+	push := func(body string) *event.GitDetails {
+		r := httptest.NewRequest("POST", "https://github.com/invisirisk-demo/app.git/git-receive-pack", strings.NewReader(body))
+		e := Git{}.Classify(r)
+		require.Equal(t, "push", e.Action)
+		return e.Details.(*event.GitDetails)
+	}
+
+	d := push(pkt(base.id()+" "+next.id()+" refs/heads/main\x00report-status side-band-64k\n", "") + pack(next, blob, delta))
+	require.Equal(t, "push", d.Operation)
+	require.Equal(t, []event.RefUpdate{{Ref: "refs/heads/main", Old: base.id(), New: next.id()}}, d.Refs)
+	require.False(t, d.Force)
+
+	d = push(pkt(
+		base.id()+" "+rewritten.id()+" refs/heads/main\x00report-status\n",
+		base.id()+" "+next.id()+" refs/heads/next\n",
+		"") + pack(blob, rewritten, next))
+	require.True(t, d.Force)
+	require.Equal(t, []event.RefUpdate{
+		{Ref: "refs/heads/main", Old: base.id(), New: rewritten.id(), Force: true},
+		{Ref: "refs/heads/next", Old: base.id(), New: next.id()},
+	}, d.Refs)
+
+	// Creating and deleting refs is never forced.
+	d = push(pkt(
+		zeroID+" "+next.id()+" refs/tags/v1.0.0\x00report-status\n",
+		base.id()+" "+zeroID+" refs/heads/old\n",
+		"") + pack(next))
+	require.Len(t, d.Refs, 2)
+	require.False(t, d.Force)
+}
+
+func TestPackCommitsDeclaredSize(t *testing.T) {
+	next := commit(commit().id())
+	require.Contains(t, packCommits([]byte(pack(object{3, []byte("hello")}, next))), next.id())
+
+	// A blob declared as five bytes that inflates to a megabyte is not read
+	// past its size, and nothing after it is trusted.
+	var b bytes.Buffer
+	b.WriteString("PACK")
+	binary.Write(&b, binary.BigEndian, uint32(2))
+	binary.Write(&b, binary.BigEndian, uint32(2))
+	b.WriteByte(3<<4 | 5)
+	zw := zlib.NewWriter(&b)
+	zw.Write(bytes.Repeat([]byte("x"), 1<<20))
+	zw.Close()
+	b.WriteString(pack(next)[12:])
+	require.Empty(t, packCommits(b.Bytes()))
+}
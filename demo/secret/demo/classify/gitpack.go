@@ -0,0 +1,148 @@
+package classify
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// pktLines returns the data lines of a pkt-line stream, skipping flush,
+// delimiter and response-end packets, up to the first malformed packet.
+func pktLines(b []byte) []string {
+	var lines []string
+	for len(b) >= 4 {
+		n, err := strconv.ParseUint(string(b[:4]), 16, 16)
+		if err != nil {
+			break
+		}
+		if n < 4 {
+			b = b[4:]
+			continue
+		}
+		if int(n) > len(b) {
+			break
+		}
+		lines = append(lines, strings.TrimSuffix(string(b[4:n]), "\n"))
+		b = b[n:]
+	}
+	return lines
+}
+
+// pktCommands returns the data lines before the first flush packet and
+// what follows it.
+func pktCommands(b []byte) ([]string, []byte) {
+	var lines []string
+	for len(b) >= 4 {
+		n, err := strconv.ParseUint(string(b[:4]), 16, 16)
+		if err != nil || int(n) > len(b) {
+			break
+		}
+		if n == 0 {
+			return lines, b[4:]
+		}
+		if n >= 4 {
+			lines = append(lines, strings.TrimSuffix(string(b[4:n]), "\n"))
+		}
+		b = b[n:]
+	}
+	return lines, nil
+}
+
+// Pack object types.
+const (
+	objCommit   = 1
+	objOfsDelta = 6
+	objRefDelta = 7
+)
+
+// packCommits returns the parents of each whole commit in a packfile,
+// keyed by commit id. Deltified commits are skipped and parsing stops at
+// the end of a truncated pack.
+func packCommits(b []byte) map[string][]string {
+	parents := map[string][]string{}
+	i := bytes.Index(b, []byte("PACK"))
+	if i < 0 || len(b) < i+12 {
+		return parents
+	}
+	count := binary.BigEndian.Uint32(b[i+8 : i+12])
+	r := bytes.NewReader(b[i+12:])
+	for n := uint32(0); n < count; n++ {
+		typ, size, err := packObjectHeader(r)
+		if err != nil {
+			break
+		}
+		switch typ {
+		case objOfsDelta:
+			for {
+				c, err := r.ReadByte()
+				if err != nil || c&0x80 == 0 {
+					break
+				}
+			}
+		case objRefDelta:
+			if _, err := r.Seek(20, io.SeekCurrent); err != nil {
+				return parents
+			}
+		}
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			break
+		}
+		// Inflate no more than the declared size, so a small pack cannot
+		// expand without bound, and stop at an object that does not
+		// inflate to exactly its size.
+		lr := io.LimitReader(zr, int64(size)+1)
+		var data []byte
+		var got int64
+		if typ == objCommit {
+			data, err = io.ReadAll(lr)
+			got = int64(len(data))
+		} else {
+			got, err = io.Copy(io.Discard, lr)
+		}
+		if err != nil || uint64(got) != size {
+			break
+		}
+		if typ == objCommit {
+			id := sha1.Sum(append([]byte(fmt.Sprintf("commit %d\x00", len(data))), data...))
+			parents[hex.EncodeToString(id[:])] = commitParents(data)
+		}
+	}
+	return parents
+}
+
+// packObjectHeader reads an object's type and inflated size.
+func packObjectHeader(r io.ByteReader) (int, uint64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	typ, size, shift := int(c>>4&7), uint64(c&15), 4
+	for c&0x80 != 0 {
+		if c, err = r.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= uint64(c&0x7f) << shift
+		shift += 7
+	}
+	return typ, size, nil
+}
+
+// commitParents returns the parent lines of a commit's header.
+func commitParents(data []byte) []string {
+	var parents []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() && sc.Text() != "" {
+		if id, ok := cutPrefix(sc.Text(), "parent "); ok {
+			parents = append(parents, id)
+		}
+	}
+	return parents
+}
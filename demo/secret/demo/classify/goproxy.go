@@ -0,0 +1,121 @@
+package classify
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"inivisirisk.com/demo/demo/event"
+)
+
+// GoProxy classifies Go module proxy and checksum database requests. The
+// action is the operation: list, info, mod, zip, latest or lookup.
+type GoProxy struct {
+	// Proxies are the base URLs of additional GOPROXY servers, e.g.
+	// https://artifactory.example.com/api/go/go-remote.
+	// proxy.golang.org and sum.golang.org are always recognized.
+	Proxies []string
+}
+
+// Classify implements Classifier.
+func (g *GoProxy) Classify(r *http.Request) *event.Event {
+	h, p := host(r), r.URL.EscapedPath()
+	if h == "sum.golang.org" {
+		return sumLookup(h, p)
+	}
+	if h == "proxy.golang.org" {
+		if rest, ok := cutPrefix(p, "/sumdb/sum.golang.org"); ok {
+			return sumLookup(h, rest)
+		}
+		return proxyRequest(h, p)
+	}
+	if rest, ok := trimBase(g.Proxies, h, p); ok {
+		return proxyRequest(h, rest)
+	}
+	return nil
+}
+
+var errBadEscape = errors.New("bad module path escape")
+
+// proxyRequest classifies a path of the GOPROXY protocol.
+func proxyRequest(proxy, p string) *event.Event {
+	p = strings.TrimPrefix(p, "/")
+	if mod, ok := cutSuffix(p, "/@latest"); ok {
+		return goEvent("latest", proxy, mod, "")
+	}
+	i := strings.LastIndex(p, "/@v/")
+	if i < 0 {
+		return nil
+	}
+	mod, file := p[:i], p[i+len("/@v/"):]
+	if file == "list" {
+		return goEvent("list", proxy, mod, "")
+	}
+	for _, op := range []string{"info", "mod", "zip"} {
+		if version, ok := cutSuffix(file, "."+op); ok {
+			return goEvent(op, proxy, mod, version)
+		}
+	}
+	return nil
+}
+
+// sumLookup classifies a checksum database path. Only lookups name a
+// module; tiles are not reported.
+func sumLookup(db, p string) *event.Event {
+	rest, ok := cutPrefix(p, "/lookup/")
+	if !ok {
+		return nil
+	}
+	i := strings.LastIndex(rest, "@")
+	if i < 0 {
+		return nil
+	}
+	return goEvent("lookup", db, rest[:i], rest[i+1:])
+}
+
+func goEvent(op, proxy, mod, version string) *event.Event {
+	mod, err1 := unescape(mod)
+	version, err2 := unescape(version)
+	if err1 != nil || err2 != nil || mod == "" {
+		return nil
+	}
+	return event.New(op, &event.GoDetails{Module: mod, Version: version, Proxy: proxy})
+}
+
+// unescape undoes URL escaping and the module proxy case encoding, in which
+// an upper case letter is written as ! followed by the lower case letter.
+func unescape(s string) (string, error) {
+	s, err := url.PathUnescape(s)
+	if err != nil || !strings.Contains(s, "!") {
+		return s, err
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '!' && i+1 < len(s) && 'a' <= s[i+1] && s[i+1] <= 'z' {
+			b.WriteByte(s[i+1] - 'a' + 'A')
+			i++
+			continue
+		}
+		if c == '!' {
+			return "", errBadEscape
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
+
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+func cutSuffix(s, suffix string) (string, bool) {
+	if !strings.HasSuffix(s, suffix) {
+		return s, false
+	}
+	return s[:len(s)-len(suffix)], true
+}
@@ -0,0 +1,66 @@
+package classify
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/event"
+)
+
+func TestGoProxy(t *testing.T) {
+	g := &GoProxy{Proxies: []string{"https://artifactory.example.com/api/go/go-remote/"}}
+	cases := []struct {
+		url     string
+		op      string
+		details *event.GoDetails
+	}{
+		{"https://proxy.golang.org/github.com/hirochachacha/go-smb2/@v/list", "list",
+			&event.GoDetails{Module: "github.com/hirochachacha/go-smb2", Proxy: "proxy.golang.org"}},
+		{"https://proxy.golang.org/github.com/hirochachacha/go-smb2/@v/v1.1.0.info", "info",
+			&event.GoDetails{Module: "github.com/hirochachacha/go-smb2", Version: "v1.1.0", Proxy: "proxy.golang.org"}},
+		{"https://proxy.golang.org/github.com/spf13/cobra/@v/v1.6.1.mod", "mod",
+			&event.GoDetails{Module: "github.com/spf13/cobra", Version: "v1.6.1", Proxy: "proxy.golang.org"}},
+		{"https://proxy.golang.org/golang.org/x/crypto/@v/v0.0.0-20200728195943-123391ffb6de.zip", "zip",
+			&event.GoDetails{Module: "golang.org/x/crypto", Version: "v0.0.0-20200728195943-123391ffb6de", Proxy: "proxy.golang.org"}},
+		{"https://proxy.golang.org/github.com/!burnt!sushi/toml/@latest", "latest",
+			&event.GoDetails{Module: "github.com/BurntSushi/toml", Proxy: "proxy.golang.org"}},
+		{"https://sum.golang.org/lookup/github.com/stretchr/testify@v1.8.2", "lookup",
+			&event.GoDetails{Module: "github.com/stretchr/testify", Version: "v1.8.2", Proxy: "sum.golang.org"}},
+		{"https://proxy.golang.org/sumdb/sum.golang.org/lookup/golang.org/x/text@v0.9.0", "lookup",
+			&event.GoDetails{Module: "golang.org/x/text", Version: "v0.9.0", Proxy: "proxy.golang.org"}},
+		{"https://artifactory.example.com/api/go/go-remote/github.com/spf13/pflag/@v/v1.0.5.zip", "zip",
+			&event.GoDetails{Module: "github.com/spf13/pflag", Version: "v1.0.5", Proxy: "artifactory.example.com"}},
+		// Clients may name the port.
+		{"https://proxy.golang.org:443/golang.org/x/text/@v/v0.9.0.mod", "mod",
+			&event.GoDetails{Module: "golang.org/x/text", Version: "v0.9.0", Proxy: "proxy.golang.org"}},
+		{"https://artifactory.example.com:443/api/go/go-remote/github.com/spf13/pflag/@v/v1.0.5.zip", "zip",
+			&event.GoDetails{Module: "github.com/spf13/pflag", Version: "v1.0.5", Proxy: "artifactory.example.com"}},
+	}
+	for _, c := range cases {
+		e := g.Classify(httptest.NewRequest("GET", c.url, nil))
+		require.NotNil(t, e, c.url)
+		require.Equal(t, event.Go, e.Type)
+		require.Equal(t, c.op, e.Action, c.url)
+		require.Equal(t, c.details, e.Details, c.url)
+	}
+}
+
+func TestGoProxyIgnores(t *testing.T) {
+	g := &GoProxy{}
+	for _, u := range []string{
+		"https://sum.golang.org/tile/8/0/x071/123",
+		"https://proxy.golang.org/",
+		"https://example.com/github.com/spf13/cobra/@v/list",
+		"https://proxy.golang.org/github.com/!!bad/@v/list",
+	} {
+		require.Nil(t, g.Classify(httptest.NewRequest("GET", u, nil)), u)
+	}
+}
+
+func TestDefaultFallsBackToWeb(t *testing.T) {
+	e := Default().Classify(httptest.NewRequest("POST", "https://risky.com/post-target", nil))
+	require.Equal(t, "web - post - risky.com/post-target", e.Title())
+	e = Default().Classify(httptest.NewRequest("GET", "https://proxy.golang.org/golang.org/x/text/@v/list", nil))
+	require.Equal(t, "go - list - golang.org/x/text", e.Title())
+}
@@ -0,0 +1,91 @@
+package classify
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"inivisirisk.com/demo/demo/event"
+)
+
+// mavenSidecars are the checksum and signature files published next to
+// every Maven repository file.
+var mavenSidecars = []string{".sha1", ".sha256", ".sha512", ".md5", ".asc"}
+
+// Maven classifies Maven repository layout requests. Artifact and POM
+// fetches are downloads, sidecar checksum fetches checksum, maven-metadata.xml
+// metadata and PUTs publish.
+type Maven struct {
+	// Repositories are the base URLs of additional repositories, e.g.
+	// https://nexus.example.com/repository/maven-public.
+	// Maven Central is always recognized.
+	Repositories []string
+}
+
+var mavenCentral = []string{
+	"https://repo.maven.apache.org/maven2",
+	"https://repo1.maven.org/maven2",
+}
+
+// Classify implements Classifier.
+func (m *Maven) Classify(r *http.Request) *event.Event {
+	h := host(r)
+	p, ok := trimBase(mavenCentral, h, r.URL.EscapedPath())
+	if !ok {
+		if p, ok = trimBase(m.Repositories, h, p); !ok {
+			return nil
+		}
+	}
+	segs := strings.Split(strings.Trim(p, "/"), "/")
+	file := segs[len(segs)-1]
+	d := &event.MavenDetails{File: file, Repository: h}
+
+	base, sidecar := file, ""
+	for _, ext := range mavenSidecars {
+		if b, ok := cutSuffix(file, ext); ok {
+			base, sidecar = b, ext[1:]
+			break
+		}
+	}
+
+	if base == "maven-metadata.xml" {
+		// Snapshot versions have metadata of their own.
+		if len(segs) >= 4 && strings.HasSuffix(segs[len(segs)-2], "-SNAPSHOT") {
+			d.Version, segs = segs[len(segs)-2], segs[:len(segs)-1]
+		}
+		if len(segs) < 3 {
+			return nil
+		}
+		d.ArtifactID = segs[len(segs)-2]
+		d.GroupID = strings.Join(segs[:len(segs)-2], ".")
+		return mavenEvent(r, "metadata", sidecar, d)
+	}
+
+	if len(segs) < 4 {
+		return nil
+	}
+	d.Version = segs[len(segs)-2]
+	d.ArtifactID = segs[len(segs)-3]
+	d.GroupID = strings.Join(segs[:len(segs)-3], ".")
+	// Snapshot files carry a timestamp in place of -SNAPSHOT.
+	if !strings.HasPrefix(base, d.ArtifactID+"-"+strings.TrimSuffix(d.Version, "-SNAPSHOT")) {
+		return nil
+	}
+	d.DownloadType = strings.TrimPrefix(path.Ext(base), ".")
+	return mavenEvent(r, "download", sidecar, d)
+}
+
+func mavenEvent(r *http.Request, action, sidecar string, d *event.MavenDetails) *event.Event {
+	switch {
+	case r.Method == http.MethodPut:
+		action = "publish"
+	case r.Method != http.MethodGet && r.Method != http.MethodHead:
+		return nil
+	case sidecar != "":
+		action = "checksum"
+	}
+	if sidecar != "" {
+		d.DownloadType = sidecar
+	}
+	return event.New(action, d)
+}
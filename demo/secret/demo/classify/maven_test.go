@@ -0,0 +1,61 @@
+package classify
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/event"
+)
+
+func TestMaven(t *testing.T) {
+	m := &Maven{Repositories: []string{"https://nexus.example.com/repository/maven-public/"}}
+	slf4j := func(file, typ string) *event.MavenDetails {
+		return &event.MavenDetails{GroupID: "org.slf4j", ArtifactID: "slf4j-api", Version: "2.0.7", File: file, Repository: "repo.maven.apache.org",
+			Download: event.Download{DownloadType: typ}}
+	}
+	cases := []struct {
+		method, url string
+		action      string
+		details     *event.MavenDetails
+	}{
+		{"GET", "https://repo.maven.apache.org/maven2/org/slf4j/slf4j-api/2.0.7/slf4j-api-2.0.7.jar", "download",
+			slf4j("slf4j-api-2.0.7.jar", "jar")},
+		{"GET", "https://repo.maven.apache.org/maven2/org/slf4j/slf4j-api/2.0.7/slf4j-api-2.0.7.pom", "download",
+			slf4j("slf4j-api-2.0.7.pom", "pom")},
+		{"GET", "https://repo.maven.apache.org/maven2/org/slf4j/slf4j-api/2.0.7/slf4j-api-2.0.7-sources.jar", "download",
+			slf4j("slf4j-api-2.0.7-sources.jar", "jar")},
+		{"GET", "https://repo.maven.apache.org/maven2/org/slf4j/slf4j-api/2.0.7/slf4j-api-2.0.7.jar.sha1", "checksum",
+			slf4j("slf4j-api-2.0.7.jar.sha1", "sha1")},
+		{"GET", "https://repo1.maven.org/maven2/org/slf4j/slf4j-api/maven-metadata.xml", "metadata",
+			&event.MavenDetails{GroupID: "org.slf4j", ArtifactID: "slf4j-api", File: "maven-metadata.xml", Repository: "repo1.maven.org"}},
+		{"GET", "https://nexus.example.com/repository/maven-public/com/invisirisk/demo/1.0-SNAPSHOT/maven-metadata.xml.sha256", "checksum",
+			&event.MavenDetails{GroupID: "com.invisirisk", ArtifactID: "demo", Version: "1.0-SNAPSHOT", File: "maven-metadata.xml.sha256", Repository: "nexus.example.com",
+				Download: event.Download{DownloadType: "sha256"}}},
+		{"PUT", "https://nexus.example.com/repository/maven-public/com/invisirisk/demo/1.0-SNAPSHOT/demo-1.0-20230430.120000-1.jar", "publish",
+			&event.MavenDetails{GroupID: "com.invisirisk", ArtifactID: "demo", Version: "1.0-SNAPSHOT", File: "demo-1.0-20230430.120000-1.jar", Repository: "nexus.example.com",
+				Download: event.Download{DownloadType: "jar"}}},
+	}
+	for _, c := range cases {
+		e := m.Classify(httptest.NewRequest(c.method, c.url, nil))
+		require.NotNil(t, e, c.url)
+		require.Equal(t, event.Maven, e.Type)
+		require.Equal(t, c.action, e.Action, c.url)
+		require.Equal(t, c.details, e.Details, c.url)
+	}
+	e := m.Classify(httptest.NewRequest("GET", "https://repo.maven.apache.org/maven2/org/slf4j/slf4j-api/2.0.7/slf4j-api-2.0.7.jar", nil))
+	require.Equal(t, "mvn - download - org.slf4j:slf4j-api:2.0.7", e.Title())
+}
+
+func TestMavenIgnores(t *testing.T) {
+	m := &Maven{}
+	for _, u := range []string{
+		"https://repo.maven.apache.org/maven2/",
+		"https://repo.maven.apache.org/maven2/org/slf4j/slf4j-api/2.0.7/other-2.0.7.jar",
+		"https://repo.maven.apache.org/maven2/org/maven-metadata.xml",
+		"https://repo.maven.apache.org/robots.txt",
+		"https://nexus.example.com/repository/maven-public/org/slf4j/slf4j-api/2.0.7/slf4j-api-2.0.7.jar",
+	} {
+		require.Nil(t, m.Classify(httptest.NewRequest("GET", u, nil)), u)
+	}
+}
@@ -0,0 +1,90 @@
+package classify
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"inivisirisk.com/demo/demo/event"
+)
+
+// NPM classifies npm registry requests. Packument and version document
+// reads are metadata, tarball fetches download and PUTs publish.
+type NPM struct {
+	// Registries are the base URLs of additional registries.
+	// registry.npmjs.org, registry.yarnpkg.com and npm.pkg.github.com are
+	// always recognized.
+	Registries []string
+}
+
+var npmRegistries = map[string]bool{
+	"registry.npmjs.org":   true,
+	"registry.yarnpkg.com": true,
+	"npm.pkg.github.com":   true,
+}
+
+// Classify implements Classifier.
+func (n *NPM) Classify(r *http.Request) *event.Event {
+	h, p := host(r), r.URL.EscapedPath()
+	if !npmRegistries[h] {
+		var ok bool
+		if p, ok = trimBase(n.Registries, h, p); !ok {
+			return nil
+		}
+	}
+	p, err := url.PathUnescape(p)
+	if err != nil {
+		return nil
+	}
+	segs := strings.Split(strings.Trim(p, "/"), "/")
+	d := &event.NPMDetails{Registry: h}
+
+	// GitHub Packages serves tarballs from
+	// /download/@owner/name/version/sha.
+	github := h == "npm.pkg.github.com" && segs[0] == "download"
+	if github {
+		segs = segs[1:]
+	}
+	if len(segs) > 0 && strings.HasPrefix(segs[0], "@") {
+		d.Scope, segs = segs[0], segs[1:]
+	}
+	if len(segs) == 0 || !validNPMName(segs[0]) || (d.Scope != "" && !validNPMName(d.Scope[1:])) {
+		return nil
+	}
+	d.Package, segs = segs[0], segs[1:]
+
+	switch {
+	case r.Method == http.MethodPut && len(segs) == 0 && !github:
+		return event.New("publish", d)
+	case r.Method != http.MethodGet && r.Method != http.MethodHead:
+		return nil
+	case github:
+		if len(segs) != 2 {
+			return nil
+		}
+		d.Version = segs[0]
+		d.DownloadType = "tgz"
+		return event.New("download", d)
+	case len(segs) == 0:
+		return event.New("metadata", d)
+	case len(segs) == 1:
+		d.Version = segs[0]
+		return event.New("metadata", d)
+	case len(segs) == 2 && segs[0] == "-":
+		version, ok1 := cutPrefix(segs[1], d.Package+"-")
+		version, ok2 := cutSuffix(version, ".tgz")
+		if !ok1 || !ok2 || version == "" {
+			return nil
+		}
+		d.Version = version
+		d.DownloadType = "tgz"
+		return event.New("download", d)
+	}
+	return nil
+}
+
+// validNPMName rejects the registry's own endpoints, such as /-/v1/search,
+// which are not package names.
+func validNPMName(name string) bool {
+	return name != "" && name[0] != '-' && name[0] != '.' && name[0] != '_'
+}
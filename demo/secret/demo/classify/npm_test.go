@@ -0,0 +1,58 @@
+package classify
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/event"
+)
+
+func TestNPM(t *testing.T) {
+	n := &NPM{Registries: []string{"https://nexus.example.com/repository/npm/"}}
+	cases := []struct {
+		method, url string
+		action      string
+		details     *event.NPMDetails
+	}{
+		{"GET", "https://registry.npmjs.org/color", "metadata",
+			&event.NPMDetails{Package: "color", Registry: "registry.npmjs.org"}},
+		{"GET", "https://registry.npmjs.org/color/4.2.3", "metadata",
+			&event.NPMDetails{Package: "color", Version: "4.2.3", Registry: "registry.npmjs.org"}},
+		{"GET", "https://registry.npmjs.org/color/-/color-4.2.3.tgz", "download",
+			&event.NPMDetails{Package: "color", Version: "4.2.3", Registry: "registry.npmjs.org", Download: event.Download{DownloadType: "tgz"}}},
+		{"GET", "https://registry.npmjs.org/@types%2fnode", "metadata",
+			&event.NPMDetails{Scope: "@types", Package: "node", Registry: "registry.npmjs.org"}},
+		{"GET", "https://registry.yarnpkg.com/@babel/core/-/core-7.21.0.tgz", "download",
+			&event.NPMDetails{Scope: "@babel", Package: "core", Version: "7.21.0", Registry: "registry.yarnpkg.com", Download: event.Download{DownloadType: "tgz"}}},
+		{"GET", "https://npm.pkg.github.com/@invisirisk%2fir-dep-npm", "metadata",
+			&event.NPMDetails{Scope: "@invisirisk", Package: "ir-dep-npm", Registry: "npm.pkg.github.com"}},
+		{"GET", "https://npm.pkg.github.com/download/@invisirisk/ir-dep-npm/1.0.5/400ac130b88475bc78aa618f8fa86e1f16f57d89", "download",
+			&event.NPMDetails{Scope: "@invisirisk", Package: "ir-dep-npm", Version: "1.0.5", Registry: "npm.pkg.github.com", Download: event.Download{DownloadType: "tgz"}}},
+		{"PUT", "https://npm.pkg.github.com/@invisirisk%2fir-dep-npm", "publish",
+			&event.NPMDetails{Scope: "@invisirisk", Package: "ir-dep-npm", Registry: "npm.pkg.github.com"}},
+		{"GET", "https://nexus.example.com/repository/npm/colorjs/-/colorjs-0.1.9.tgz", "download",
+			&event.NPMDetails{Package: "colorjs", Version: "0.1.9", Registry: "nexus.example.com", Download: event.Download{DownloadType: "tgz"}}},
+	}
+	for _, c := range cases {
+		e := n.Classify(httptest.NewRequest(c.method, c.url, nil))
+		require.NotNil(t, e, c.url)
+		require.Equal(t, event.NPM, e.Type)
+		require.Equal(t, c.action, e.Action, c.url)
+		require.Equal(t, c.details, e.Details, c.url)
+	}
+}
+
+func TestNPMIgnores(t *testing.T) {
+	n := &NPM{}
+	for _, c := range []struct{ method, url string }{
+		{"POST", "https://registry.npmjs.org/-/npm/v1/security/audits/quick"},
+		{"GET", "https://registry.npmjs.org/-/v1/search?text=color"},
+		{"GET", "https://registry.npmjs.org/"},
+		{"GET", "https://registry.npmjs.org/color/-/other-4.2.3.tgz"},
+		{"DELETE", "https://registry.npmjs.org/color/-rev/1-abc"},
+		{"GET", "https://nexus.example.com/repository/npm/color"},
+	} {
+		require.Nil(t, n.Classify(httptest.NewRequest(c.method, c.url, nil)), c.url)
+	}
+}
@@ -0,0 +1,94 @@
+package classify
+
+import (
+	"net/http"
+	"strings"
+
+	"inivisirisk.com/demo/demo/event"
+)
+
+// OCI classifies OCI distribution API requests on any host. Manifest and
+// blob reads are pull, uploads and manifest writes push, deletes delete,
+// tag listings list and token requests auth.
+type OCI struct{}
+
+// Classify implements Classifier.
+func (OCI) Classify(r *http.Request) *event.Event {
+	if e := ociToken(r); e != nil {
+		return e
+	}
+	rest, ok := cutPrefix(r.URL.Path, "/v2/")
+	if !ok {
+		return nil
+	}
+	d := &event.OCIDetails{Registry: host(r)}
+	var action string
+	switch {
+	case strings.HasSuffix(rest, "/tags/list"):
+		d.Repository, d.Object = strings.TrimSuffix(rest, "/tags/list"), "tags"
+		action = "list"
+	case strings.Contains(rest, "/blobs/uploads"):
+		i := strings.LastIndex(rest, "/blobs/uploads")
+		d.Repository, d.Object = rest[:i], "blob"
+		d.Digest = r.URL.Query().Get("digest")
+		if d.Digest == "" {
+			d.Digest = r.URL.Query().Get("mount")
+		}
+		action = "push"
+	case strings.Contains(rest, "/manifests/"), strings.Contains(rest, "/blobs/"):
+		i := strings.LastIndex(rest, "/")
+		ref := rest[i+1:]
+		d.Repository, d.Object = rest[:i], "manifest"
+		if repo, ok := cutSuffix(d.Repository, "/blobs"); ok {
+			d.Repository, d.Object = repo, "blob"
+		} else {
+			d.Repository = strings.TrimSuffix(d.Repository, "/manifests")
+		}
+		switch {
+		case ref == "":
+			return nil
+		case strings.Contains(ref, ":"):
+			d.Digest = ref
+		default:
+			d.Tag = ref
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			action = "pull"
+		case http.MethodPut:
+			action = "push"
+			d.MediaType = r.Header.Get("Content-Type")
+		case http.MethodDelete:
+			action = "delete"
+		}
+	}
+	if action == "" || d.Repository == "" || strings.Contains(d.Repository, "/manifests/") {
+		return nil
+	}
+	return event.New(action, d)
+}
+
+// ociToken classifies a registry token request, which names the registry
+// in service and the repository and requested access in scope, e.g.
+// repository:library/node:pull.
+func ociToken(r *http.Request) *event.Event {
+	q := r.URL.Query()
+	service := q.Get("service")
+	if service == "" || !(strings.HasSuffix(r.URL.Path, "/token") || strings.HasSuffix(r.URL.Path, "/auth")) {
+		return nil
+	}
+	d := &event.OCIDetails{Registry: service}
+	for _, scope := range q["scope"] {
+		repo, ok := cutPrefix(scope, "repository:")
+		if !ok {
+			continue
+		}
+		i := strings.LastIndex(repo, ":")
+		if i < 0 {
+			continue
+		}
+		d.Repository, d.Scope = repo[:i], repo[i+1:]
+		break
+	}
+	return event.New("auth", d)
+}
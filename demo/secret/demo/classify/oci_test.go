@@ -0,0 +1,69 @@
+package classify
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/event"
+)
+
+const nodeDigest = "sha256:4d9b7b6b1d2d3e5c1a1b0f2c7e4c3d6a8b9f0e1d2c3b4a5968778695a4b3c2d1"
+
+func TestOCI(t *testing.T) {
+	cases := []struct {
+		method, url string
+		action      string
+		details     *event.OCIDetails
+	}{
+		{"GET", "https://registry-1.docker.io/v2/library/node/manifests/19-alpine", "pull",
+			&event.OCIDetails{Registry: "registry-1.docker.io", Repository: "library/node", Object: "manifest", Tag: "19-alpine"}},
+		{"HEAD", "https://ghcr.io/v2/invisirisk/pse/manifests/" + nodeDigest, "pull",
+			&event.OCIDetails{Registry: "ghcr.io", Repository: "invisirisk/pse", Object: "manifest", Digest: nodeDigest}},
+		{"GET", "https://registry-1.docker.io/v2/library/golang/blobs/" + nodeDigest, "pull",
+			&event.OCIDetails{Registry: "registry-1.docker.io", Repository: "library/golang", Object: "blob", Digest: nodeDigest}},
+		{"POST", "https://ghcr.io/v2/invisirisk/pse/blobs/uploads/", "push",
+			&event.OCIDetails{Registry: "ghcr.io", Repository: "invisirisk/pse", Object: "blob"}},
+		{"POST", "https://ghcr.io/v2/invisirisk/pse/blobs/uploads/?mount=" + nodeDigest + "&from=invisirisk/base", "push",
+			&event.OCIDetails{Registry: "ghcr.io", Repository: "invisirisk/pse", Object: "blob", Digest: nodeDigest}},
+		{"PUT", "https://ghcr.io/v2/invisirisk/pse/blobs/uploads/6f1c?digest=" + nodeDigest, "push",
+			&event.OCIDetails{Registry: "ghcr.io", Repository: "invisirisk/pse", Object: "blob", Digest: nodeDigest}},
+		{"DELETE", "https://ghcr.io/v2/invisirisk/pse/manifests/" + nodeDigest, "delete",
+			&event.OCIDetails{Registry: "ghcr.io", Repository: "invisirisk/pse", Object: "manifest", Digest: nodeDigest}},
+		{"GET", "https://ghcr.io/v2/invisirisk/pse/tags/list?n=100", "list",
+			&event.OCIDetails{Registry: "ghcr.io", Repository: "invisirisk/pse", Object: "tags"}},
+		{"GET", "https://ghcr.io:443/v2/invisirisk/pse/tags/list", "list",
+			&event.OCIDetails{Registry: "ghcr.io", Repository: "invisirisk/pse", Object: "tags"}},
+		{"GET", "https://auth.docker.io/token?scope=repository%3Alibrary%2Fnode%3Apull&service=registry.docker.io", "auth",
+			&event.OCIDetails{Registry: "registry.docker.io", Repository: "library/node", Scope: "pull"}},
+		{"GET", "https://ghcr.io/token?scope=repository:invisirisk/pse:pull,push&service=ghcr.io", "auth",
+			&event.OCIDetails{Registry: "ghcr.io", Repository: "invisirisk/pse", Scope: "pull,push"}},
+		{"GET", "https://registry.gitlab.com/jwt/auth?service=container_registry", "auth",
+			&event.OCIDetails{Registry: "container_registry"}},
+	}
+	for _, c := range cases {
+		e := OCI{}.Classify(httptest.NewRequest(c.method, c.url, nil))
+		require.NotNil(t, e, c.url)
+		require.Equal(t, event.OCI, e.Type)
+		require.Equal(t, c.action, e.Action, c.url)
+		require.Equal(t, c.details, e.Details, c.url)
+	}
+
+	r := httptest.NewRequest("PUT", "https://ghcr.io/v2/invisirisk/pse/manifests/v1.0.0", nil)
+	r.Header.Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+	e := Default().Classify(r)
+	require.Equal(t, "oci - push - ghcr.io/invisirisk/pse:v1.0.0", e.Title())
+	require.Equal(t, "application/vnd.oci.image.manifest.v1+json", e.Details.(*event.OCIDetails).MediaType)
+}
+
+func TestOCIIgnores(t *testing.T) {
+	for _, c := range []struct{ method, url string }{
+		{"GET", "https://registry-1.docker.io/v2/"},
+		{"GET", "https://registry-1.docker.io/v2/library/node/manifests/"},
+		{"PATCH", "https://registry-1.docker.io/v2/library/node/manifests/latest"},
+		{"GET", "https://api.example.com/v2/users"},
+		{"GET", "https://example.com/token"},
+	} {
+		require.Nil(t, OCI{}.Classify(httptest.NewRequest(c.method, c.url, nil)), c.url)
+	}
+}
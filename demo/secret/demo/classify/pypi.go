@@ -0,0 +1,103 @@
+package classify
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"inivisirisk.com/demo/demo/event"
+)
+
+// PyPI classifies Python package index requests. Simple index and JSON API
+// reads are metadata and wheel, sdist and PEP 658 metadata file fetches
+// download.
+type PyPI struct {
+	// Indexes are the base URLs of additional indexes, under which /simple/,
+	// /pypi/ and /packages/ are served, e.g.
+	// https://nexus.example.com/repository/pypi. pypi.org and
+	// files.pythonhosted.org are always recognized.
+	Indexes []string
+}
+
+// Classify implements Classifier.
+func (p *PyPI) Classify(r *http.Request) *event.Event {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return nil
+	}
+	h, rest := host(r), r.URL.EscapedPath()
+	switch h {
+	case "pypi.org", "files.pythonhosted.org":
+	default:
+		var ok bool
+		if rest, ok = trimBase(p.Indexes, h, rest); !ok {
+			return nil
+		}
+	}
+	rest, err := url.PathUnescape(rest)
+	if err != nil {
+		return nil
+	}
+	segs := strings.Split(strings.Trim(rest, "/"), "/")
+	d := &event.PyPIDetails{Index: h}
+	switch {
+	case len(segs) == 2 && segs[0] == "simple":
+		d.Project = normalizePyPI(segs[1])
+		return event.New("metadata", d)
+	case len(segs) == 3 && segs[0] == "pypi" && segs[2] == "json":
+		d.Project = normalizePyPI(segs[1])
+		return event.New("metadata", d)
+	case len(segs) == 4 && segs[0] == "pypi" && segs[3] == "json":
+		d.Project, d.Version = normalizePyPI(segs[1]), segs[2]
+		return event.New("metadata", d)
+	case len(segs) > 1 && segs[0] == "packages":
+		d.Filename = segs[len(segs)-1]
+		project, version, typ := parsePyPIFilename(strings.TrimSuffix(d.Filename, ".metadata"))
+		if project == "" {
+			return nil
+		}
+		d.Project, d.Version, d.DownloadType = project, version, typ
+		if strings.HasSuffix(d.Filename, ".metadata") {
+			d.DownloadType = "metadata"
+		}
+		return event.New("download", d)
+	}
+	return nil
+}
+
+var pypiSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizePyPI returns the PEP 503 normalized form of a project name.
+func normalizePyPI(name string) string {
+	return strings.ToLower(pypiSeparators.ReplaceAllString(name, "-"))
+}
+
+// parsePyPIFilename returns the project, version and type of a
+// distribution file name: a wheel, whose fields are separated by dashes,
+// or an sdist, whose version follows the last dash.
+func parsePyPIFilename(name string) (project, version, typ string) {
+	if base, ok := cutSuffix(name, ".whl"); ok {
+		f := strings.Split(base, "-")
+		if len(f) < 5 {
+			return "", "", ""
+		}
+		return normalizePyPI(f[0]), f[1], "wheel"
+	}
+	for _, ext := range []string{".tar.gz", ".tar.bz2", ".zip", ".tgz"} {
+		if base, ok := cutSuffix(name, ext); ok {
+			i := strings.LastIndex(base, "-")
+			if i <= 0 || i == len(base)-1 {
+				return "", "", ""
+			}
+			return normalizePyPI(base[:i]), base[i+1:], "sdist"
+		}
+	}
+	if path.Ext(name) == ".egg" {
+		f := strings.Split(strings.TrimSuffix(name, ".egg"), "-")
+		if len(f) >= 2 {
+			return normalizePyPI(f[0]), f[1], "egg"
+		}
+	}
+	return "", "", ""
+}
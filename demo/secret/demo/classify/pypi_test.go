@@ -0,0 +1,62 @@
+package classify
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/event"
+)
+
+func TestPyPI(t *testing.T) {
+	p := &PyPI{Indexes: []string{"https://nexus.example.com/repository/pypi"}}
+	cases := []struct {
+		url     string
+		action  string
+		details *event.PyPIDetails
+	}{
+		{"https://pypi.org/simple/Requests/", "metadata",
+			&event.PyPIDetails{Project: "requests", Index: "pypi.org"}},
+		{"https://pypi.org/simple/zope.interface/", "metadata",
+			&event.PyPIDetails{Project: "zope-interface", Index: "pypi.org"}},
+		{"https://pypi.org/pypi/requests/json", "metadata",
+			&event.PyPIDetails{Project: "requests", Index: "pypi.org"}},
+		{"https://pypi.org/pypi/requests/2.31.0/json", "metadata",
+			&event.PyPIDetails{Project: "requests", Version: "2.31.0", Index: "pypi.org"}},
+		{"https://files.pythonhosted.org/packages/70/8e/0e2d847013cb52cd35b38c009bb167a1a26b2ce6cd6965bf26b47bc0bf44/requests-2.31.0-py3-none-any.whl", "download",
+			&event.PyPIDetails{Project: "requests", Version: "2.31.0", Filename: "requests-2.31.0-py3-none-any.whl", Index: "files.pythonhosted.org",
+				Download: event.Download{DownloadType: "wheel"}}},
+		{"https://files.pythonhosted.org/packages/9d/be/10918a2eac4ae9f02f6cfe6414b7a155ccd8f7f9d4380d62fd5b955065c3/requests-2.31.0.tar.gz", "download",
+			&event.PyPIDetails{Project: "requests", Version: "2.31.0", Filename: "requests-2.31.0.tar.gz", Index: "files.pythonhosted.org",
+				Download: event.Download{DownloadType: "sdist"}}},
+		{"https://files.pythonhosted.org/packages/70/8e/0e2d/typing_extensions-4.5.0-py3-none-any.whl.metadata", "download",
+			&event.PyPIDetails{Project: "typing-extensions", Version: "4.5.0", Filename: "typing_extensions-4.5.0-py3-none-any.whl.metadata", Index: "files.pythonhosted.org",
+				Download: event.Download{DownloadType: "metadata"}}},
+		{"https://nexus.example.com/repository/pypi/packages/python-dateutil/2.8.2/python-dateutil-2.8.2.tar.gz", "download",
+			&event.PyPIDetails{Project: "python-dateutil", Version: "2.8.2", Filename: "python-dateutil-2.8.2.tar.gz", Index: "nexus.example.com",
+				Download: event.Download{DownloadType: "sdist"}}},
+	}
+	for _, c := range cases {
+		e := p.Classify(httptest.NewRequest("GET", c.url, nil))
+		require.NotNil(t, e, c.url)
+		require.Equal(t, event.PyPI, e.Type)
+		require.Equal(t, c.action, e.Action, c.url)
+		require.Equal(t, c.details, e.Details, c.url)
+	}
+	e := p.Classify(httptest.NewRequest("GET", "https://pypi.org/pypi/requests/2.31.0/json", nil))
+	require.Equal(t, "pypi - metadata - requests==2.31.0", e.Title())
+}
+
+func TestPyPIIgnores(t *testing.T) {
+	p := &PyPI{}
+	for _, c := range []struct{ method, url string }{
+		{"GET", "https://pypi.org/project/requests/"},
+		{"GET", "https://pypi.org/simple/"},
+		{"GET", "https://files.pythonhosted.org/packages/70/8e/README.md"},
+		{"GET", "https://files.pythonhosted.org/packages/70/8e/broken-py3.whl"},
+		{"POST", "https://pypi.org/simple/requests/"},
+		{"GET", "https://nexus.example.com/repository/pypi/simple/requests/"},
+	} {
+		require.Nil(t, p.Classify(httptest.NewRequest(c.method, c.url, nil)), c.url)
+	}
+}
@@ -0,0 +1,277 @@
+// Package event defines the activities PSE reports and feeds to policies.
+// An event is encoded as the policy input:
+//
+//	{"type": "git", "action": "pull", "details": {"repo": "github.com/TheTorProject/gettorbrowser"}}
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"inivisirisk.com/demo/demo/secrets"
+)
+
+// Type is the kind of activity, and the policy package deciding on it.
+type Type string
+
+const (
+	Git   Type = "git"
+	Web   Type = "web"
+	Go    Type = "go"
+	NPM   Type = "npm"
+	Maven Type = "mvn"
+	PyPI  Type = "pypi"
+	OCI   Type = "oci"
+	SMB   Type = "smb"
+)
+
+// Details are the type specific fields of an event.
+type Details interface {
+	// EventType is the type of events carrying these details.
+	EventType() Type
+	// Target names what the activity was about, as shown in reports.
+	Target() string
+}
+
+// Event is one activity of a build.
+type Event struct {
+	Type    Type      `json:"type"`
+	Action  string    `json:"action"`
+	Time    time.Time `json:"time"`
+	Details Details   `json:"details"`
+}
+
+// New returns an event of the type of d.
+func New(action string, d Details) *Event {
+	return &Event{Type: d.EventType(), Action: action, Details: d}
+}
+
+// Title is the report heading of the event, e.g.
+// "git - pull - github.com/TheTorProject/gettorbrowser".
+func (e *Event) Title() string {
+	return fmt.Sprintf("%s - %s - %s", e.Type, e.Action, e.Details.Target())
+}
+
+// MarshalJSON implements json.Marshaler, leaving out a zero time.
+func (e *Event) MarshalJSON() ([]byte, error) {
+	var t *time.Time
+	if !e.Time.IsZero() {
+		t = &e.Time
+	}
+	return json.Marshal(struct {
+		Type    Type       `json:"type"`
+		Action  string     `json:"action"`
+		Time    *time.Time `json:"time,omitempty"`
+		Details Details    `json:"details"`
+	}{e.Type, e.Action, t, e.Details})
+}
+
+// UnmarshalJSON decodes the details into the struct of the event's type.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type    Type            `json:"type"`
+		Action  string          `json:"action"`
+		Time    time.Time       `json:"time"`
+		Details json.RawMessage `json:"details"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	newDetails, ok := detailTypes[raw.Type]
+	if !ok {
+		return fmt.Errorf("event: unknown type %q", raw.Type)
+	}
+	d := newDetails()
+	if len(raw.Details) > 0 {
+		if err := json.Unmarshal(raw.Details, d); err != nil {
+			return fmt.Errorf("event: %s details: %w", raw.Type, err)
+		}
+	}
+	e.Type, e.Action, e.Time, e.Details = raw.Type, raw.Action, raw.Time, d
+	return nil
+}
+
+// detailTypes creates empty details for each event type.
+var detailTypes = map[Type]func() Details{
+	Git:   func() Details { return &GitDetails{} },
+	Web:   func() Details { return &WebDetails{} },
+	Go:    func() Details { return &GoDetails{} },
+	NPM:   func() Details { return &NPMDetails{} },
+	Maven: func() Details { return &MavenDetails{} },
+	PyPI:  func() Details { return &PyPIDetails{} },
+	OCI:   func() Details { return &OCIDetails{} },
+	SMB:   func() Details { return &SMBDetails{} },
+}
+
+// Types lists the known event types.
+func Types() []Type {
+	return []Type{Git, Web, Go, NPM, Maven, PyPI, OCI, SMB}
+}
+
+// Download describes content the build received.
+type Download struct {
+	DownloadType     string `json:"download_type,omitempty"`
+	DownloadChecksum string `json:"download_checksum,omitempty"`
+}
+
+// GitDetails describe a git operation; actions are pull and push.
+type GitDetails struct {
+	Repo string `json:"repo"`
+	URL  string `json:"url,omitempty"`
+	// Operation is clone, fetch or push for smart HTTP transfers and refs
+	// for ref advertisements.
+	Operation string      `json:"operation,omitempty"`
+	Refs      []RefUpdate `json:"refs,omitempty"`
+	// Force is set when any pushed ref may not be a fast-forward.
+	Force bool `json:"force,omitempty"`
+	Download
+}
+
+// RefUpdate is a ref changed by a push. An all zero Old creates the ref
+// and an all zero New deletes it.
+type RefUpdate struct {
+	Ref string `json:"ref"`
+	Old string `json:"old"`
+	New string `json:"new"`
+	// Force is set when the update may not be a fast-forward.
+	Force bool `json:"force,omitempty"`
+}
+
+func (*GitDetails) EventType() Type  { return Git }
+func (d *GitDetails) Target() string { return d.Repo }
+
+// WebDetails describe a plain HTTP request; the action is the lower case
+// method.
+type WebDetails struct {
+	URL     string            `json:"url"`
+	Host    string            `json:"host"`
+	Path    string            `json:"path"`
+	Secrets []secrets.Finding `json:"secrets,omitempty"`
+	Download
+}
+
+func (*WebDetails) EventType() Type  { return Web }
+func (d *WebDetails) Target() string { return d.Host + d.Path }
+
+// GoDetails describe a Go module proxy request.
+type GoDetails struct {
+	Module  string `json:"module"`
+	Version string `json:"version,omitempty"`
+	Proxy   string `json:"proxy"`
+	Download
+}
+
+func (*GoDetails) EventType() Type { return Go }
+func (d *GoDetails) Target() string {
+	if d.Version == "" {
+		return d.Module
+	}
+	return d.Module + "@" + d.Version
+}
+
+// NPMDetails describe an npm registry request.
+type NPMDetails struct {
+	Scope     string `json:"scope,omitempty"`
+	Package   string `json:"package"`
+	Version   string `json:"version,omitempty"`
+	Integrity string `json:"integrity,omitempty"`
+	Registry  string `json:"registry"`
+	Download
+}
+
+func (*NPMDetails) EventType() Type { return NPM }
+func (d *NPMDetails) Target() string {
+	name := d.Package
+	if d.Scope != "" {
+		name = d.Scope + "/" + name
+	}
+	if d.Version == "" {
+		return name
+	}
+	return name + "@" + d.Version
+}
+
+// MavenDetails describe a Maven repository request.
+type MavenDetails struct {
+	GroupID    string `json:"group_id"`
+	ArtifactID string `json:"artifact_id"`
+	Version    string `json:"version,omitempty"`
+	File       string `json:"file,omitempty"`
+	Repository string `json:"repository"`
+	Download
+}
+
+func (*MavenDetails) EventType() Type { return Maven }
+func (d *MavenDetails) Target() string {
+	gav := d.GroupID + ":" + d.ArtifactID
+	if d.Version != "" {
+		gav += ":" + d.Version
+	}
+	return gav
+}
+
+// PyPIDetails describe a Python package index request.
+type PyPIDetails struct {
+	Project  string `json:"project"`
+	Version  string `json:"version,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+	Index    string `json:"index"`
+	Download
+}
+
+func (*PyPIDetails) EventType() Type { return PyPI }
+func (d *PyPIDetails) Target() string {
+	if d.Version == "" {
+		return d.Project
+	}
+	return d.Project + "==" + d.Version
+}
+
+// OCIDetails describe a container registry request. Object is manifest,
+// blob or tags.
+type OCIDetails struct {
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Object     string `json:"object,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	MediaType  string `json:"media_type,omitempty"`
+	// Scope is the access requested by a token request, e.g. pull,push.
+	Scope string `json:"scope,omitempty"`
+	Download
+}
+
+func (*OCIDetails) EventType() Type { return OCI }
+func (d *OCIDetails) Target() string {
+	name := d.Registry
+	if d.Repository != "" {
+		name += "/" + d.Repository
+	}
+	if d.Tag != "" {
+		name += ":" + d.Tag
+	}
+	if d.Digest != "" {
+		name += "@" + d.Digest
+	}
+	return name
+}
+
+// SMBDetails describe an SMB2 connection; actions are session for an
+// authenticated session and connect for a share mounted in it.
+type SMBDetails struct {
+	Server      string `json:"server"`
+	Share       string `json:"share,omitempty"`
+	User        string `json:"user,omitempty"`
+	Domain      string `json:"domain,omitempty"`
+	Workstation string `json:"workstation,omitempty"`
+}
+
+func (*SMBDetails) EventType() Type { return SMB }
+func (d *SMBDetails) Target() string {
+	if d.Share == "" {
+		return d.Server
+	}
+	return `\\` + d.Server + `\` + d.Share
+}
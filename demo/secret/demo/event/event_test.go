@@ -0,0 +1,80 @@
+package event
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/secrets"
+)
+
+func samples() []*Event {
+	return []*Event{
+		New("pull", &GitDetails{Repo: "github.com/TheTorProject/gettorbrowser", Download: Download{DownloadType: "mime: text/plain; charset=utf-8", DownloadChecksum: "checksum cddb06e275ca09d516bc759f77ac5efe"}}),
+		New("post", &WebDetails{URL: "https://risky.com/post-target", Host: "risky.com", Path: "/", Secrets: []secrets.Finding{{Type: "GitHub-App-Token", Value: "ghs_x", Confidence: secrets.High}}}),
+		New("download", &GoDetails{Module: "github.com/hirochachacha/go-smb2", Version: "v1.1.0", Proxy: "proxy.golang.org"}),
+		New("install", &NPMDetails{Scope: "@invisirisk", Package: "demo", Version: "1.0.0", Registry: "npm.pkg.github.com"}),
+		New("download", &MavenDetails{GroupID: "org.slf4j", ArtifactID: "slf4j-api", Version: "2.0.7", File: "slf4j-api-2.0.7.jar", Repository: "repo.maven.apache.org"}),
+		New("download", &PyPIDetails{Project: "requests", Version: "2.31.0", Index: "pypi.org"}),
+		New("pull", &OCIDetails{Registry: "registry-1.docker.io", Repository: "library/node", Object: "manifest", Tag: "19-alpine"}),
+		New("connect", &SMBDetails{Server: "files.corp.example", Share: "backup", User: "builder", Domain: "CORP"}),
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, e := range samples() {
+		e.Time = time.Date(2023, 4, 30, 12, 0, 0, 0, time.UTC)
+		data, err := json.Marshal(e)
+		require.NoError(t, err)
+		var got Event
+		require.NoError(t, json.Unmarshal(data, &got))
+		require.Equal(t, e, &got, string(data))
+	}
+}
+
+func TestPolicyInput(t *testing.T) {
+	data, err := json.Marshal(New("pull", &GitDetails{Repo: "github.com/TheTorProject/gettorbrowser"}))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":"git","action":"pull","details":{"repo":"github.com/TheTorProject/gettorbrowser"}}`, string(data))
+}
+
+func TestTitle(t *testing.T) {
+	var titles []string
+	for _, e := range samples() {
+		titles = append(titles, e.Title())
+	}
+	require.Equal(t, []string{
+		"git - pull - github.com/TheTorProject/gettorbrowser",
+		"web - post - risky.com/",
+		"go - download - github.com/hirochachacha/go-smb2@v1.1.0",
+		"npm - install - @invisirisk/demo@1.0.0",
+		"mvn - download - org.slf4j:slf4j-api:2.0.7",
+		"pypi - download - requests==2.31.0",
+		"oci - pull - registry-1.docker.io/library/node:19-alpine",
+		`smb - connect - \\files.corp.example\backup`,
+	}, titles)
+}
+
+func TestUnknownType(t *testing.T) {
+	var e Event
+	require.EqualError(t, json.Unmarshal([]byte(`{"type":"ftp","action":"get"}`), &e), `event: unknown type "ftp"`)
+}
+
+func TestSchema(t *testing.T) {
+	s := Schema()
+	variants := s["oneOf"].([]interface{})
+	require.Len(t, variants, len(Types()))
+
+	web := variants[1].(map[string]interface{})["properties"].(map[string]interface{})
+	require.Equal(t, map[string]interface{}{"const": "web"}, web["type"])
+	details := web["details"].(map[string]interface{})
+	props := details["properties"].(map[string]interface{})
+	require.Contains(t, props, "download_checksum")
+	require.Equal(t, []string{"url", "host", "path"}, details["required"])
+	finding := props["secrets"].(map[string]interface{})["items"].(map[string]interface{})
+	require.Equal(t, map[string]interface{}{"type": "string"}, finding["properties"].(map[string]interface{})["confidence"])
+
+	_, err := json.Marshal(s)
+	require.NoError(t, err)
+}
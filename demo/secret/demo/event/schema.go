@@ -0,0 +1,99 @@
+package event
+
+import (
+	"encoding"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema returns a JSON Schema describing every event type, generated from
+// the Go types so that the two cannot drift apart.
+func Schema() map[string]interface{} {
+	var variants []interface{}
+	for _, t := range Types() {
+		variants = append(variants, map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"type":    map[string]interface{}{"const": string(t)},
+				"action":  map[string]interface{}{"type": "string"},
+				"time":    map[string]interface{}{"type": "string", "format": "date-time"},
+				"details": typeSchema(reflect.TypeOf(detailTypes[t]())),
+			},
+			"required":             []string{"type", "action", "details"},
+			"additionalProperties": false,
+		})
+	}
+	return map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     "https://pse.invisirisk.com/schema/event.json",
+		"title":   "PSE event",
+		"oneOf":   variants,
+	}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	// Types with custom marshalling, like secrets.Confidence, are text.
+	if t.Implements(textMarshaler) {
+		return map[string]interface{}{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		required := []string{}
+		addFields(t, props, &required)
+		return map[string]interface{}{"type": "object", "properties": props, "required": required}
+	}
+	return map[string]interface{}{}
+}
+
+// addFields adds the JSON fields of struct t, flattening embedded structs
+// as encoding/json does.
+func addFields(t reflect.Type, props map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			addFields(f.Type, props, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = typeSchema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -2,15 +2,18 @@ module inivisirisk.com/demo/demo
 
 go 1.19
 
+require (
+	github.com/hirochachacha/go-smb2 v1.1.0
+	github.com/spf13/cobra v1.6.1
+	github.com/stretchr/testify v1.8.2
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/geoffgarside/ber v1.1.0 // indirect
-	github.com/hirochachacha/go-smb2 v1.1.0 // indirect
 	github.com/inconshreveable/mousetrap v1.0.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/spf13/cobra v1.6.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	github.com/stretchr/testify v1.8.2 // indirect
 	golang.org/x/crypto v0.0.0-20200728195943-123391ffb6de // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
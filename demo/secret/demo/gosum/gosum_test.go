@@ -0,0 +1,126 @@
+package gosum
+
+import (
+	"archive/zip"
+	"bytes"
+	"go/build"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/event"
+)
+
+const pflagMod = "module github.com/spf13/pflag\n\ngo 1.12\n"
+
+func moduleZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		w.Write([]byte(body))
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestHashMod(t *testing.T) {
+	require.Equal(t, "h1:McXfInJRrz4CZXVZOBLb0bTZqETkiAhM9Iw0y3An2Bg=", HashMod([]byte(pflagMod)))
+}
+
+func TestHashZipOrderIndependent(t *testing.T) {
+	a := moduleZip(t, map[string]string{"m@v1.0.0/go.mod": "module m\n", "m@v1.0.0/m.go": "package m\n"})
+	h, err := HashZip(a)
+	require.NoError(t, err)
+	require.Regexp(t, `^h1:[A-Za-z0-9+/]{43}=$`, h)
+
+	b := moduleZip(t, map[string]string{"m@v1.0.0/m.go": "package m\n", "m@v1.0.0/go.mod": "module m\n"})
+	hb, err := HashZip(b)
+	require.NoError(t, err)
+	require.Equal(t, h, hb)
+
+	c := moduleZip(t, map[string]string{"m@v1.0.0/go.mod": "module m\n", "m@v1.0.0/m.go": "package m // tampered\n"})
+	hc, err := HashZip(c)
+	require.NoError(t, err)
+	require.NotEqual(t, h, hc)
+
+	_, err = HashZip([]byte("not a zip"))
+	require.Error(t, err)
+}
+
+// TestModuleCache checks the zips of this module's dependencies against
+// its own go.sum when they are in the module cache.
+func TestModuleCache(t *testing.T) {
+	data, err := os.ReadFile("../go.sum")
+	require.NoError(t, err)
+	sums, err := ParseGoSum(data)
+	require.NoError(t, err)
+
+	cache := os.Getenv("GOMODCACHE")
+	if cache == "" {
+		cache = filepath.Join(build.Default.GOPATH, "pkg", "mod")
+	}
+	dir := filepath.Join(cache, "cache", "download", "github.com", "hirochachacha", "go-smb2", "@v")
+	zipData, err := os.ReadFile(filepath.Join(dir, "v1.1.0.zip"))
+	if err != nil {
+		t.Skip("go-smb2 is not in the module cache")
+	}
+	h, err := HashZip(zipData)
+	require.NoError(t, err)
+	require.Equal(t, sums["github.com/hirochachacha/go-smb2 v1.1.0"], h)
+
+	mod, err := os.ReadFile(filepath.Join(dir, "v1.1.0.mod"))
+	require.NoError(t, err)
+	require.Equal(t, sums["github.com/hirochachacha/go-smb2 v1.1.0/go.mod"], HashMod(mod))
+}
+
+func TestParse(t *testing.T) {
+	_, err := ParseGoSum([]byte("github.com/spf13/pflag v1.0.5\n"))
+	require.EqualError(t, err, "gosum: line 1: malformed")
+
+	sums, err := ParseLookup([]byte(`12345
+github.com/spf13/pflag v1.0.5 h1:iy+VFUOCP1a+8yFto/drg2CJ5u0yRoB7fZw3DKv/JXA=
+github.com/spf13/pflag v1.0.5/go.mod h1:McXfInJRrz4CZXVZOBLb0bTZqETkiAhM9Iw0y3An2Bg=
+
+go.sum database tree
+20000000
+AAAA
+
+— sum.golang.org Az3grn4z
+`))
+	require.NoError(t, err)
+	require.Equal(t, Sums{
+		"github.com/spf13/pflag v1.0.5":        "h1:iy+VFUOCP1a+8yFto/drg2CJ5u0yRoB7fZw3DKv/JXA=",
+		"github.com/spf13/pflag v1.0.5/go.mod": "h1:McXfInJRrz4CZXVZOBLb0bTZqETkiAhM9Iw0y3An2Bg=",
+	}, sums)
+}
+
+func TestVerifier(t *testing.T) {
+	v := NewVerifier()
+	require.NoError(t, v.LoadGoSum("../go.sum"))
+
+	mod := event.New("mod", &event.GoDetails{Module: "github.com/spf13/pflag", Version: "v1.0.5", Proxy: "proxy.golang.org"})
+	require.True(t, v.Wants(mod))
+	require.Empty(t, v.Inspect(mod, []byte(pflagMod)))
+	require.Equal(t, "h1:McXfInJRrz4CZXVZOBLb0bTZqETkiAhM9Iw0y3An2Bg=", mod.Details.(*event.GoDetails).DownloadChecksum)
+
+	alerts := v.Inspect(mod, []byte(pflagMod+"require evil.com/x v1.0.0\n"))
+	require.Len(t, alerts, 1)
+	require.Equal(t, "alert/crit", alerts[0].Result)
+	require.Contains(t, alerts[0].Details, "github.com/spf13/pflag v1.0.5/go.mod: proxy.golang.org download has h1:")
+	require.Contains(t, alerts[0].Details, "go.sum has h1:McXfInJRrz4CZXVZOBLb0bTZqETkiAhM9Iw0y3An2Bg=")
+
+	// A module missing from go.sum is checked against a later lookup.
+	zipData := moduleZip(t, map[string]string{"example.com/m@v1.0.0/go.mod": "module example.com/m\n"})
+	z := event.New("zip", &event.GoDetails{Module: "example.com/m", Version: "v1.0.0", Proxy: "proxy.golang.org"})
+	require.Empty(t, v.Inspect(z, zipData))
+	lookup := event.New("lookup", &event.GoDetails{Module: "example.com/m", Version: "v1.0.0", Proxy: "sum.golang.org"})
+	alerts = v.Inspect(lookup, []byte("1\nexample.com/m v1.0.0 h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n\ntree\n"))
+	require.Len(t, alerts, 1)
+	require.Contains(t, alerts[0].Details, "example.com/m v1.0.0: sum.golang.org has h1:AAAA")
+
+	require.False(t, v.Wants(event.New("list", &event.GoDetails{Module: "example.com/m"})))
+	require.False(t, v.Wants(event.New("get", &event.WebDetails{})))
+}
@@ -0,0 +1,64 @@
+// Package gosum checks Go modules fetched through the proxy against the
+// build's go.sum and the checksum database.
+package gosum
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// HashZip returns the h1: hash of a module zip, as recorded in go.sum for
+// "module version". It is the dirhash Hash1 of the files in the zip.
+func HashZip(data []byte) (string, error) {
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("gosum: %w", err)
+	}
+	files := make(map[string]*zip.File, len(z.File))
+	names := make([]string, 0, len(z.File))
+	for _, f := range z.File {
+		files[f.Name] = f
+		names = append(names, f.Name)
+	}
+	return hash1(names, func(name string) (io.ReadCloser, error) { return files[name].Open() })
+}
+
+// HashMod returns the h1: hash of a go.mod file, as recorded in go.sum for
+// "module version/go.mod".
+func HashMod(data []byte) string {
+	h, _ := hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+	return h
+}
+
+// hash1 hashes the sorted "sha256  name" lines of files.
+func hash1(names []string, open func(string) (io.ReadCloser, error)) (string, error) {
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	sum := sha256.New()
+	for _, name := range names {
+		if strings.Contains(name, "\n") {
+			return "", errors.New("gosum: file names with newlines are not supported")
+		}
+		r, err := open(name)
+		if err != nil {
+			return "", fmt.Errorf("gosum: %s: %w", name, err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return "", fmt.Errorf("gosum: %s: %w", name, err)
+		}
+		fmt.Fprintf(sum, "%x  %s\n", h.Sum(nil), name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(sum.Sum(nil)), nil
+}
@@ -0,0 +1,163 @@
+package gosum
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"inivisirisk.com/demo/demo/event"
+	"inivisirisk.com/demo/demo/policy"
+)
+
+// Sums maps "module version" and "module version/go.mod" to h1: hashes.
+type Sums map[string]string
+
+// ParseGoSum parses go.sum lines. Hashes other than h1: are ignored.
+func ParseGoSum(data []byte) (Sums, error) {
+	sums := Sums{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) != 3 {
+			return nil, fmt.Errorf("gosum: line %d: malformed", n)
+		}
+		if strings.HasPrefix(f[2], "h1:") {
+			sums[f[0]+" "+f[1]] = f[2]
+		}
+	}
+	return sums, sc.Err()
+}
+
+// ParseLookup parses a checksum database lookup response: a record number,
+// the go.sum lines of the module and, after a blank line, the signed tree
+// head.
+func ParseLookup(data []byte) (Sums, error) {
+	_, rest, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		return nil, fmt.Errorf("gosum: malformed lookup response")
+	}
+	lines, _, _ := bytes.Cut(rest, []byte("\n\n"))
+	return ParseGoSum(lines)
+}
+
+// Mismatch is a module whose hash differs between two sources.
+type Mismatch struct {
+	Key       string
+	Got, Want string
+	// Source is where Got came from and WantSource where Want was first
+	// seen, e.g. go.sum, sum.golang.org or a download.
+	Source, WantSource string
+}
+
+func (m *Mismatch) Error() string {
+	return fmt.Sprintf("gosum: %s: %s has %s, %s has %s", m.Key, m.Source, m.Got, m.WantSource, m.Want)
+}
+
+type known struct {
+	hash, source string
+}
+
+// Verifier remembers every hash it sees, from go.sum files, checksum
+// database lookups and downloaded modules, and reports any that disagree.
+// It is safe for concurrent use.
+type Verifier struct {
+	mu    sync.Mutex
+	known map[string]known
+}
+
+// NewVerifier returns an empty verifier.
+func NewVerifier() *Verifier {
+	return &Verifier{known: map[string]known{}}
+}
+
+// LoadGoSum adds the hashes in a go.sum file.
+func (v *Verifier) LoadGoSum(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sums, err := ParseGoSum(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if m := v.Add("go.sum", sums); len(m) > 0 {
+		return m[0]
+	}
+	return nil
+}
+
+// Add records sums from source, returning those that disagree with hashes
+// seen before.
+func (v *Verifier) Add(source string, sums Sums) []*Mismatch {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var mismatches []*Mismatch
+	for key, hash := range sums {
+		k, ok := v.known[key]
+		if !ok {
+			v.known[key] = known{hash, source}
+			continue
+		}
+		if k.hash != hash {
+			mismatches = append(mismatches, &Mismatch{Key: key, Got: hash, Source: source, Want: k.hash, WantSource: k.source})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Key < mismatches[j].Key })
+	return mismatches
+}
+
+// Wants reports whether e is a module zip, go.mod or checksum database
+// lookup.
+func (v *Verifier) Wants(e *event.Event) bool {
+	if e == nil || e.Type != event.Go {
+		return false
+	}
+	switch e.Action {
+	case "zip", "mod", "lookup":
+		return true
+	}
+	return false
+}
+
+// Inspect hashes a downloaded zip or go.mod, recording the hash as the
+// download checksum of e, or records the hashes of a lookup response. Any
+// mismatch is a critical alert.
+func (v *Verifier) Inspect(e *event.Event, body []byte) []policy.Decision {
+	d, ok := e.Details.(*event.GoDetails)
+	if !ok || !v.Wants(e) {
+		return nil
+	}
+	source := d.Proxy + " download"
+	sums := Sums{}
+	switch e.Action {
+	case "zip":
+		h, err := HashZip(body)
+		if err != nil {
+			return []policy.Decision{{Result: "alert/error", Details: err.Error()}}
+		}
+		sums[d.Module+" "+d.Version] = h
+		d.DownloadType, d.DownloadChecksum = "zip", h
+	case "mod":
+		h := HashMod(body)
+		sums[d.Module+" "+d.Version+"/go.mod"] = h
+		d.DownloadType, d.DownloadChecksum = "mod", h
+	case "lookup":
+		var err error
+		if sums, err = ParseLookup(body); err != nil {
+			return []policy.Decision{{Result: "alert/error", Details: err.Error()}}
+		}
+		source = d.Proxy
+	}
+	var alerts []policy.Decision
+	for _, m := range v.Add(source, sums) {
+		alerts = append(alerts, policy.Decision{Result: "alert/crit", Details: m.Error()})
+	}
+	return alerts
+}
@@ -0,0 +1,54 @@
+// Package integrity checks packages downloaded through the proxy against
+// the checksums their registries publish. Each verifier is a proxy
+// inspector raising a critical alert when a download hashes differently
+// from what its registry published.
+package integrity
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"inivisirisk.com/demo/demo/policy"
+)
+
+type known struct {
+	sum, source string
+}
+
+// ledger remembers the first checksum seen for each key.
+type ledger struct {
+	mu    sync.Mutex
+	known map[string]known
+}
+
+// check records sums from source and returns an alert for each one that
+// differs from an earlier record.
+func (l *ledger) check(source string, sums map[string]string) []policy.Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.known == nil {
+		l.known = map[string]known{}
+	}
+	keys := make([]string, 0, len(sums))
+	for key := range sums {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var alerts []policy.Decision
+	for _, key := range keys {
+		sum := sums[key]
+		k, ok := l.known[key]
+		if !ok {
+			l.known[key] = known{sum, source}
+			continue
+		}
+		if k.sum != sum {
+			alerts = append(alerts, policy.Decision{
+				Result:  "alert/crit",
+				Details: fmt.Sprintf("integrity: %s: %s has %s, %s has %s", key, source, sum, k.source, k.sum),
+			})
+		}
+	}
+	return alerts
+}
@@ -0,0 +1,77 @@
+package integrity
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"strings"
+
+	"inivisirisk.com/demo/demo/event"
+	"inivisirisk.com/demo/demo/policy"
+)
+
+// mavenHashes are the sidecar checksums a download is compared with.
+var mavenHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// Maven checks repository files against their .md5, .sha1, .sha256 and
+// .sha512 sidecars. The zero value is ready to use.
+type Maven struct {
+	ledger ledger
+}
+
+// Wants reports whether e is a Maven file or checksum download.
+func (m *Maven) Wants(e *event.Event) bool {
+	if e == nil || e.Type != event.Maven {
+		return false
+	}
+	switch e.Action {
+	case "download", "metadata":
+		return true
+	case "checksum":
+		d, ok := e.Details.(*event.MavenDetails)
+		return ok && mavenHashes[d.DownloadType] != nil
+	}
+	return false
+}
+
+// Inspect hashes a downloaded file, setting its sha256 as the download
+// checksum of e, or records the digest in a sidecar.
+func (m *Maven) Inspect(e *event.Event, body []byte) []policy.Decision {
+	d, ok := e.Details.(*event.MavenDetails)
+	if !ok || !m.Wants(e) {
+		return nil
+	}
+	// Metadata is merged per repository, so files are only compared
+	// within one.
+	prefix := d.Repository + "/" + strings.ReplaceAll(d.GroupID, ".", "/") + "/" + d.ArtifactID + "/"
+	if d.Version != "" {
+		prefix += d.Version + "/"
+	}
+
+	sums := map[string]string{}
+	if e.Action == "checksum" {
+		alg := d.DownloadType
+		// Sidecars hold the hex digest, sometimes followed by the file name.
+		f := strings.Fields(string(body))
+		if len(f) == 0 {
+			return nil
+		}
+		sums[prefix+strings.TrimSuffix(d.File, "."+alg)+" "+alg] = strings.ToLower(f[0])
+		return m.ledger.check(d.Repository+" ."+alg+" sidecar", sums)
+	}
+	for alg, newHash := range mavenHashes {
+		h := newHash()
+		h.Write(body)
+		sums[prefix+d.File+" "+alg] = hex.EncodeToString(h.Sum(nil))
+	}
+	d.DownloadChecksum = "sha256:" + sums[prefix+d.File+" sha256"]
+	return m.ledger.check(d.Repository+" download", sums)
+}
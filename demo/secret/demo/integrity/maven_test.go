@@ -0,0 +1,41 @@
+package integrity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/event"
+)
+
+// sha1 and sha256 of "jar".
+const (
+	jarSHA1   = "f92e777f4341930bad9b2422283c4680d00dbc06"
+	jarSHA256 = "0163f1eea7894350060624d315234d40c508ab251ba121714e234503045faadd"
+)
+
+func TestMaven(t *testing.T) {
+	m := &Maven{}
+	file := func(action, name, typ string) *event.Event {
+		return event.New(action, &event.MavenDetails{GroupID: "org.slf4j", ArtifactID: "slf4j-api", Version: "2.0.7", File: name,
+			Repository: "repo.maven.apache.org", Download: event.Download{DownloadType: typ}})
+	}
+
+	jar := file("download", "slf4j-api-2.0.7.jar", "jar")
+	require.True(t, m.Wants(jar))
+	require.Empty(t, m.Inspect(jar, []byte("jar")))
+	require.Equal(t, "sha256:"+jarSHA256, jar.Details.(*event.MavenDetails).DownloadChecksum)
+
+	require.Empty(t, m.Inspect(file("checksum", "slf4j-api-2.0.7.jar.sha1", "sha1"), []byte(jarSHA1+"  slf4j-api-2.0.7.jar\n")))
+	require.Empty(t, m.Inspect(file("checksum", "slf4j-api-2.0.7.jar.sha256", "sha256"), []byte(jarSHA256)))
+
+	// The sidecar can also arrive first.
+	sidecar := file("checksum", "slf4j-api-2.0.7.pom.sha1", "sha1")
+	require.Empty(t, m.Inspect(sidecar, []byte(jarSHA1)))
+	alerts := m.Inspect(file("download", "slf4j-api-2.0.7.pom", "pom"), []byte("tampered"))
+	require.Len(t, alerts, 1)
+	require.Equal(t, "alert/crit", alerts[0].Result)
+	require.Equal(t, "integrity: repo.maven.apache.org/org/slf4j/slf4j-api/2.0.7/slf4j-api-2.0.7.pom sha1: repo.maven.apache.org download has 93d6c93d9a76d27ec3462e7b57de5df1eb45bc7b, repo.maven.apache.org .sha1 sidecar has "+jarSHA1, alerts[0].Details)
+
+	require.False(t, m.Wants(file("checksum", "slf4j-api-2.0.7.jar.asc", "asc")))
+	require.False(t, m.Wants(event.New("download", &event.NPMDetails{})))
+}
@@ -0,0 +1,84 @@
+package integrity
+
+import (
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"inivisirisk.com/demo/demo/event"
+	"inivisirisk.com/demo/demo/policy"
+)
+
+// NPM checks tarballs against the dist.integrity and dist.shasum of their
+// packuments. The zero value is ready to use.
+type NPM struct {
+	ledger ledger
+}
+
+type npmDist struct {
+	Integrity string `json:"integrity"`
+	Shasum    string `json:"shasum"`
+}
+
+// Wants reports whether e is an npm metadata read or tarball download.
+func (n *NPM) Wants(e *event.Event) bool {
+	return e != nil && e.Type == event.NPM && (e.Action == "metadata" || e.Action == "download")
+}
+
+// Inspect records the checksums in a packument or version document, or
+// hashes a tarball, setting the integrity of e.
+func (n *NPM) Inspect(e *event.Event, body []byte) []policy.Decision {
+	d, ok := e.Details.(*event.NPMDetails)
+	if !ok || !n.Wants(e) {
+		return nil
+	}
+	name := d.Package
+	if d.Scope != "" {
+		name = d.Scope + "/" + name
+	}
+	sums := map[string]string{}
+	if e.Action == "download" {
+		s512, s1 := sha512.Sum512(body), sha1.Sum(body)
+		d.Integrity = "sha512-" + base64.StdEncoding.EncodeToString(s512[:])
+		sums[name+"@"+d.Version+" sha512"] = d.Integrity
+		sums[name+"@"+d.Version+" sha1"] = "sha1-" + base64.StdEncoding.EncodeToString(s1[:])
+		return n.ledger.check(d.Registry+" download", sums)
+	}
+
+	var doc struct {
+		Version  string  `json:"version"`
+		Dist     npmDist `json:"dist"`
+		Versions map[string]struct {
+			Dist npmDist `json:"dist"`
+		} `json:"versions"`
+	}
+	if json.Unmarshal(body, &doc) != nil {
+		return nil
+	}
+	if doc.Version != "" {
+		addNPMSums(sums, name+"@"+doc.Version, doc.Dist)
+	}
+	for version, v := range doc.Versions {
+		addNPMSums(sums, name+"@"+version, v.Dist)
+	}
+	return n.ledger.check(d.Registry+" packument", sums)
+}
+
+// addNPMSums adds the subresource integrity hashes of dist, converting a
+// hex shasum to the sha1- form.
+func addNPMSums(sums map[string]string, key string, dist npmDist) {
+	for _, sri := range strings.Fields(dist.Integrity) {
+		alg, _, ok := strings.Cut(sri, "-")
+		if ok && (alg == "sha512" || alg == "sha1") {
+			sums[key+" "+alg] = sri
+		}
+	}
+	if b, err := hex.DecodeString(dist.Shasum); err == nil && len(b) == sha1.Size {
+		if _, ok := sums[key+" sha1"]; !ok {
+			sums[key+" sha1"] = "sha1-" + base64.StdEncoding.EncodeToString(b)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package integrity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/event"
+)
+
+const (
+	// sha512 and sha1 of "tarball".
+	tarballSHA512 = "sha512-WBQM9fuLkpBn60cFcU9GUnOBEyhwVxbOpyle0gD/abK/W01QtcFtEsDGj3RZYWrpP2UxasHjQ2plCE6FrzLYdg=="
+	tarballShasum = "e10f6e70661d167ef514ab6e6d98607438c6a8c6"
+)
+
+func TestNPM(t *testing.T) {
+	n := &NPM{}
+	packument := event.New("metadata", &event.NPMDetails{Package: "color", Registry: "registry.npmjs.org"})
+	require.True(t, n.Wants(packument))
+	require.Empty(t, n.Inspect(packument, []byte(`{"name":"color","versions":{
+		"4.2.3":{"dist":{"integrity":"`+tarballSHA512+`","shasum":"`+tarballShasum+`"}},
+		"4.2.2":{"dist":{"shasum":"`+tarballShasum+`"}}}}`)))
+
+	download := func(version string) *event.Event {
+		return event.New("download", &event.NPMDetails{Package: "color", Version: version, Registry: "registry.npmjs.org"})
+	}
+	e := download("4.2.3")
+	require.Empty(t, n.Inspect(e, []byte("tarball")))
+	require.Equal(t, tarballSHA512, e.Details.(*event.NPMDetails).Integrity)
+
+	alerts := n.Inspect(download("4.2.2"), []byte("tampered"))
+	require.Len(t, alerts, 1)
+	require.Equal(t, "alert/crit", alerts[0].Result)
+	require.Contains(t, alerts[0].Details, "integrity: color@4.2.2 sha1: registry.npmjs.org download has sha1-")
+
+	// A version document read after the download is checked too.
+	doc := event.New("metadata", &event.NPMDetails{Scope: "@invisirisk", Package: "ir-dep-npm", Version: "1.0.5", Registry: "npm.pkg.github.com"})
+	dep := event.New("download", &event.NPMDetails{Scope: "@invisirisk", Package: "ir-dep-npm", Version: "1.0.5", Registry: "npm.pkg.github.com"})
+	require.Empty(t, n.Inspect(dep, []byte("tampered")))
+	alerts = n.Inspect(doc, []byte(`{"version":"1.0.5","dist":{"integrity":"`+tarballSHA512+`"}}`))
+	require.Len(t, alerts, 1)
+	require.Contains(t, alerts[0].Details, "@invisirisk/ir-dep-npm@1.0.5 sha512: npm.pkg.github.com packument has "+tarballSHA512+", npm.pkg.github.com download has sha512-")
+
+	require.False(t, n.Wants(event.New("publish", &event.NPMDetails{})))
+	require.Empty(t, n.Inspect(event.New("metadata", &event.NPMDetails{}), []byte("not json")))
+}
@@ -0,0 +1,59 @@
+package integrity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"inivisirisk.com/demo/demo/event"
+	"inivisirisk.com/demo/demo/policy"
+)
+
+// OCI checks pulled manifests against the digests addressing them, and
+// records the digest and media type of manifests pulled by tag.
+//
+// Blobs are not verified. Registries answer blob pulls with a redirect to
+// a CDN, whose download the proxy sees as an unrelated request, and layers
+// are often larger than the proxy buffers for inspection.
+type OCI struct{}
+
+// Wants reports whether e is a manifest pull.
+func (OCI) Wants(e *event.Event) bool {
+	if e == nil || e.Type != event.OCI || e.Action != "pull" {
+		return false
+	}
+	d, ok := e.Details.(*event.OCIDetails)
+	return ok && d.Object == "manifest"
+}
+
+// Inspect hashes the pulled content. Content addressed by something other
+// than sha256 is only recorded.
+func (o OCI) Inspect(e *event.Event, body []byte) []policy.Decision {
+	if !o.Wants(e) {
+		return nil
+	}
+	d := e.Details.(*event.OCIDetails)
+	sum := sha256.Sum256(body)
+	got := "sha256:" + hex.EncodeToString(sum[:])
+	d.DownloadChecksum = got
+	if d.MediaType == "" {
+		var m struct {
+			MediaType string `json:"mediaType"`
+		}
+		if json.Unmarshal(body, &m) == nil {
+			d.MediaType = m.MediaType
+		}
+	}
+	switch {
+	case d.Digest == "":
+		d.Digest = got
+	case strings.HasPrefix(d.Digest, "sha256:") && d.Digest != got:
+		return []policy.Decision{{
+			Result:  "alert/crit",
+			Details: fmt.Sprintf("integrity: %s: %s download has %s", d.Target(), d.Registry, got),
+		}}
+	}
+	return nil
+}
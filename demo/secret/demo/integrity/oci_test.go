@@ -0,0 +1,39 @@
+package integrity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/event"
+)
+
+const (
+	manifest       = `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`
+	manifestDigest = "sha256:74650f9ea72d624d418435f57b997feec86725c0dccb55d3c9e96d6b8d0669b0"
+)
+
+func TestOCI(t *testing.T) {
+	pull := func(object, tag, digest string) *event.Event {
+		return event.New("pull", &event.OCIDetails{Registry: "registry-1.docker.io", Repository: "library/node", Object: object, Tag: tag, Digest: digest})
+	}
+	o := OCI{}
+
+	byTag := pull("manifest", "19-alpine", "")
+	require.True(t, o.Wants(byTag))
+	require.Empty(t, o.Inspect(byTag, []byte(manifest)))
+	d := byTag.Details.(*event.OCIDetails)
+	require.Equal(t, manifestDigest, d.Digest)
+	require.Equal(t, "application/vnd.docker.distribution.manifest.v2+json", d.MediaType)
+	require.Equal(t, "oci - pull - registry-1.docker.io/library/node:19-alpine@"+manifestDigest, byTag.Title())
+
+	require.Empty(t, o.Inspect(pull("manifest", "", manifestDigest), []byte(manifest)))
+
+	alerts := o.Inspect(pull("manifest", "", manifestDigest), []byte("tampered"))
+	require.Len(t, alerts, 1)
+	require.Equal(t, "alert/crit", alerts[0].Result)
+	require.Contains(t, alerts[0].Details, "integrity: registry-1.docker.io/library/node@"+manifestDigest+": registry-1.docker.io download has sha256:")
+
+	require.False(t, o.Wants(event.New("push", &event.OCIDetails{Object: "manifest"})))
+	require.False(t, o.Wants(event.New("pull", &event.OCIDetails{Object: "tags"})))
+	require.False(t, o.Wants(pull("blob", "", manifestDigest)))
+}
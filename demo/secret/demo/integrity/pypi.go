@@ -0,0 +1,124 @@
+package integrity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"inivisirisk.com/demo/demo/event"
+	"inivisirisk.com/demo/demo/policy"
+)
+
+// PyPI checks distribution files against the sha256 hashes in the simple
+// index, in HTML or JSON form, and the JSON API. The zero value is ready to
+// use.
+type PyPI struct {
+	ledger ledger
+}
+
+type pypiFile struct {
+	Filename     string            `json:"filename"`
+	Hashes       map[string]string `json:"hashes"`
+	Digests      map[string]string `json:"digests"`
+	CoreMetadata json.RawMessage   `json:"core-metadata"`
+}
+
+var (
+	anchorRe = regexp.MustCompile(`(?i)<a\s([^>]*)>`)
+	attrRe   = regexp.MustCompile(`([\w-]+)\s*=\s*"([^"]*)"`)
+)
+
+// Wants reports whether e is a PyPI index read or file download.
+func (p *PyPI) Wants(e *event.Event) bool {
+	return e != nil && e.Type == event.PyPI && (e.Action == "metadata" || e.Action == "download")
+}
+
+// Inspect records the hashes listed by an index page, or hashes a
+// downloaded file, setting the sha256 of e.
+func (p *PyPI) Inspect(e *event.Event, body []byte) []policy.Decision {
+	d, ok := e.Details.(*event.PyPIDetails)
+	if !ok || !p.Wants(e) {
+		return nil
+	}
+	if e.Action == "download" {
+		sum := sha256.Sum256(body)
+		d.SHA256 = hex.EncodeToString(sum[:])
+		return p.ledger.check(d.Index+" download", map[string]string{d.Filename: d.SHA256})
+	}
+	sums := map[string]string{}
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		pypiJSONSums(body, sums)
+	} else {
+		pypiHTMLSums(body, sums)
+	}
+	return p.ledger.check(d.Index+" index", sums)
+}
+
+// pypiJSONSums reads a PEP 691 simple index page or a JSON API response.
+func pypiJSONSums(body []byte, sums map[string]string) {
+	var doc struct {
+		Files    []pypiFile            `json:"files"`
+		URLs     []pypiFile            `json:"urls"`
+		Releases map[string][]pypiFile `json:"releases"`
+	}
+	if json.Unmarshal(body, &doc) != nil {
+		return
+	}
+	files := append(doc.Files, doc.URLs...)
+	for _, release := range doc.Releases {
+		files = append(files, release...)
+	}
+	for _, f := range files {
+		if h := f.Hashes["sha256"]; h != "" {
+			sums[f.Filename] = strings.ToLower(h)
+		}
+		if h := f.Digests["sha256"]; h != "" {
+			sums[f.Filename] = strings.ToLower(h)
+		}
+		var meta map[string]string
+		if json.Unmarshal(f.CoreMetadata, &meta) == nil && meta["sha256"] != "" {
+			sums[f.Filename+".metadata"] = strings.ToLower(meta["sha256"])
+		}
+	}
+}
+
+// pypiHTMLSums reads the links of a PEP 503 simple index page, whose URL
+// fragments carry the file hashes.
+func pypiHTMLSums(body []byte, sums map[string]string) {
+	for _, a := range anchorRe.FindAllSubmatch(body, -1) {
+		attrs := map[string]string{}
+		for _, m := range attrRe.FindAllSubmatch(a[1], -1) {
+			attrs[strings.ToLower(string(m[1]))] = html.UnescapeString(string(m[2]))
+		}
+		u, err := url.Parse(attrs["href"])
+		if err != nil {
+			continue
+		}
+		name := path.Base(u.Path)
+		if h, ok := cutHash(u.Fragment); ok {
+			sums[name] = h
+		}
+		meta := attrs["data-core-metadata"]
+		if meta == "" {
+			meta = attrs["data-dist-info-metadata"]
+		}
+		if h, ok := cutHash(meta); ok {
+			sums[name+".metadata"] = h
+		}
+	}
+}
+
+// cutHash returns the digest of a "sha256=<hex>" value.
+func cutHash(s string) (string, bool) {
+	alg, h, ok := strings.Cut(s, "=")
+	if !ok || alg != "sha256" || h == "" {
+		return "", false
+	}
+	return strings.ToLower(h), true
+}
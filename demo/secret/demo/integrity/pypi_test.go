@@ -0,0 +1,56 @@
+package integrity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/event"
+)
+
+// sha256 of "wheel" and "sdist".
+const (
+	wheelSHA256 = "ba59926159d2aa256eb8739b8da7e2b574b960e1202c6d624cbe981cef996c91"
+	sdistSHA256 = "714772a9f82b2aeb4fa5f7092d00fe4ac4c9cdeb6800840b6ed39ea64c4d785a"
+)
+
+func TestPyPIHTML(t *testing.T) {
+	p := &PyPI{}
+	index := event.New("metadata", &event.PyPIDetails{Project: "requests", Index: "pypi.org"})
+	require.True(t, p.Wants(index))
+	require.Empty(t, p.Inspect(index, []byte(`<!DOCTYPE html>
+<html><body>
+<a href="https://files.pythonhosted.org/packages/70/8e/requests-2.31.0-py3-none-any.whl#sha256=`+wheelSHA256+`" data-requires-python="&gt;=3.7" data-core-metadata="sha256=`+sdistSHA256+`">requests-2.31.0-py3-none-any.whl</a><br />
+<a href="../../packages/9d/be/requests-2.31.0.tar.gz#sha256=`+sdistSHA256+`">requests-2.31.0.tar.gz</a><br />
+</body></html>`)))
+
+	download := func(name string) *event.Event {
+		return event.New("download", &event.PyPIDetails{Project: "requests", Version: "2.31.0", Filename: name, Index: "files.pythonhosted.org"})
+	}
+	wheel := download("requests-2.31.0-py3-none-any.whl")
+	require.Empty(t, p.Inspect(wheel, []byte("wheel")))
+	require.Equal(t, wheelSHA256, wheel.Details.(*event.PyPIDetails).SHA256)
+	require.Empty(t, p.Inspect(download("requests-2.31.0-py3-none-any.whl.metadata"), []byte("sdist")))
+
+	alerts := p.Inspect(download("requests-2.31.0.tar.gz"), []byte("tampered"))
+	require.Len(t, alerts, 1)
+	require.Equal(t, "alert/crit", alerts[0].Result)
+	require.Contains(t, alerts[0].Details, "integrity: requests-2.31.0.tar.gz: files.pythonhosted.org download has ")
+	require.Contains(t, alerts[0].Details, "pypi.org index has "+sdistSHA256)
+}
+
+func TestPyPIJSON(t *testing.T) {
+	p := &PyPI{}
+	simple := event.New("metadata", &event.PyPIDetails{Project: "requests", Index: "pypi.org"})
+	require.Empty(t, p.Inspect(simple, []byte(`{"meta":{"api-version":"1.1"},"name":"requests","files":[
+		{"filename":"requests-2.31.0-py3-none-any.whl","hashes":{"sha256":"`+wheelSHA256+`"},"core-metadata":false}]}`)))
+	api := event.New("metadata", &event.PyPIDetails{Project: "requests", Version: "2.31.0", Index: "pypi.org"})
+	require.Empty(t, p.Inspect(api, []byte(`{"info":{"name":"requests"},"urls":[
+		{"filename":"requests-2.31.0.tar.gz","digests":{"md5":"x","sha256":"`+sdistSHA256+`"}}]}`)))
+
+	download := func(name string) *event.Event {
+		return event.New("download", &event.PyPIDetails{Project: "requests", Version: "2.31.0", Filename: name, Index: "files.pythonhosted.org"})
+	}
+	require.Empty(t, p.Inspect(download("requests-2.31.0-py3-none-any.whl"), []byte("wheel")))
+	require.Empty(t, p.Inspect(download("requests-2.31.0.tar.gz"), []byte("sdist")))
+	require.Len(t, p.Inspect(download("requests-2.31.0-py3-none-any.whl"), []byte("evil")), 1)
+}
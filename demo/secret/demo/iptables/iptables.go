@@ -0,0 +1,322 @@
+// Package iptables generates and applies the nat rules that redirect build
+// traffic to the PSE proxy, and the filter rules that decide on the rest of
+// the build's egress, with iptables for IPv4 and ip6tables for IPv6.
+package iptables
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+)
+
+const (
+	// DefaultChain is the nat chain that holds the PSE redirect rules.
+	DefaultChain = "pse"
+	// DefaultProxyPort is the port the PSE proxy listens on.
+	DefaultProxyPort = 12345
+	// DefaultSMBPort is the port the PSE proxy relays SMB on.
+	DefaultSMBPort = 12445
+)
+
+// Egress is the policy for traffic that is not redirected to the proxy.
+type Egress string
+
+const (
+	// EgressAllow lets it pass without a filter chain.
+	EgressAllow Egress = "allow"
+	// EgressLog logs it to the kernel log and lets it pass.
+	EgressLog Egress = "log"
+	// EgressReject logs it and rejects it.
+	EgressReject Egress = "reject"
+)
+
+// Family selects the tables of one address family. Its value is the binary
+// managing them.
+type Family string
+
+const (
+	// IPv4 is managed with iptables.
+	IPv4 Family = "iptables"
+	// IPv6 is managed with ip6tables.
+	IPv6 Family = "ip6tables"
+)
+
+// Families are the address families setup covers, in the order it covers
+// them.
+var Families = []Family{IPv4, IPv6}
+
+// Has reports whether ip is an address of f.
+func (f Family) Has(ip net.IP) bool {
+	return ip != nil && (ip.To4() != nil) == (f == IPv4)
+}
+
+// ParseEgress checks that s names an egress policy.
+func ParseEgress(s string) (Egress, error) {
+	switch e := Egress(s); e {
+	case EgressAllow, EgressLog, EgressReject:
+		return e, nil
+	}
+	return "", fmt.Errorf("iptables: unknown egress policy %q, want allow, log or reject", s)
+}
+
+// Config describes the redirect to install.
+type Config struct {
+	Chain string
+	// ProxyIP and ProxyIP6 are the proxy's addresses. Egress of a family
+	// the proxy has no address in cannot be inspected and is rejected.
+	ProxyIP   net.IP
+	ProxyIP6  net.IP
+	ProxyPort int
+	Ports     []int
+	// SMBPort, when not zero, is the local port TCP 445 is redirected to,
+	// where an SMB forwarder passes connections on to the proxy's relay.
+	// Unlike the proxy, the relay cannot tell where a connection was headed
+	// from the connection itself.
+	SMBPort int
+	// SMBRelayPort is the port of the relay on the proxy host that the
+	// forwarder connects to.
+	SMBRelayPort int
+
+	// Egress applies to traffic that is not redirected, except to the
+	// proxy and relay ports, to DNS servers and to Allow.
+	Egress Egress
+	// DNS are the name servers builds may query; if empty, DNS is subject
+	// to Egress like any other traffic.
+	DNS []net.IP
+	// Allow are further addresses or CIDR blocks exempt from Egress.
+	Allow []string
+}
+
+// DefaultConfig returns the configuration used by the PSE action: TCP 80
+// and 443 are redirected to port 12345 of the proxy at ip or ip6, SMB is
+// left alone and any other egress is logged.
+func DefaultConfig(ip, ip6 net.IP) Config {
+	return Config{
+		Chain:        DefaultChain,
+		ProxyIP:      ip,
+		ProxyIP6:     ip6,
+		ProxyPort:    DefaultProxyPort,
+		Ports:        []int{80, 443},
+		SMBRelayPort: DefaultSMBPort,
+		Egress:       EgressLog,
+	}
+}
+
+// proxy returns the proxy address in f, or nil.
+func (cfg Config) proxy(f Family) net.IP {
+	if f == IPv4 {
+		return cfg.ProxyIP
+	}
+	return cfg.ProxyIP6
+}
+
+// State is what is already installed in the nat and filter tables.
+type State struct {
+	ChainExists bool
+	JumpExists  bool
+
+	FilterChainExists bool
+	FilterJumpExists  bool
+}
+
+// Rule is a single iptables or ip6tables invocation, without the binary
+// name.
+type Rule []string
+
+// SetupRules returns the invocations that bring the tables of f from st to
+// the state described by cfg. An existing chain is flushed and refilled so
+// that a changed proxy address is picked up.
+func SetupRules(cfg Config, f Family, st State) []Rule {
+	proxy := cfg.proxy(f)
+	if proxy == nil {
+		rules := natTeardown(cfg, st)
+		rules = append(rules, filterChain(cfg, st)...)
+		return append(rules, egressRules(cfg, f, nil, EgressReject)...)
+	}
+
+	var rules []Rule
+	if st.ChainExists {
+		rules = append(rules, Rule{"-t", "nat", "-F", cfg.Chain})
+	} else {
+		rules = append(rules, Rule{"-t", "nat", "-N", cfg.Chain})
+	}
+	if !st.JumpExists {
+		rules = append(rules, Rule{"-t", "nat", "-A", "OUTPUT", "-j", cfg.Chain})
+	}
+	dnat := func(port, to int) Rule {
+		return Rule{"-t", "nat", "-A", cfg.Chain, "-p", "tcp", "-m", "tcp", "--dport", strconv.Itoa(port),
+			"-j", "DNAT", "--to-destination", net.JoinHostPort(proxy.String(), strconv.Itoa(to))}
+	}
+	for _, port := range cfg.Ports {
+		rules = append(rules, dnat(port, cfg.ProxyPort))
+	}
+	if cfg.SMBPort != 0 {
+		rules = append(rules, Rule{"-t", "nat", "-A", cfg.Chain, "-p", "tcp", "-m", "tcp", "--dport", "445",
+			"-j", "REDIRECT", "--to-ports", strconv.Itoa(cfg.SMBPort)})
+	}
+
+	if cfg.Egress == "" || cfg.Egress == EgressAllow {
+		return append(rules, filterTeardown(cfg, st)...)
+	}
+	rules = append(rules, filterChain(cfg, st)...)
+	return append(rules, egressRules(cfg, f, proxy, cfg.Egress)...)
+}
+
+// filterChain creates or flushes the filter chain and jumps to it.
+func filterChain(cfg Config, st State) []Rule {
+	var rules []Rule
+	if st.FilterChainExists {
+		rules = append(rules, Rule{"-t", "filter", "-F", cfg.Chain})
+	} else {
+		rules = append(rules, Rule{"-t", "filter", "-N", cfg.Chain})
+	}
+	if !st.FilterJumpExists {
+		rules = append(rules, Rule{"-t", "filter", "-A", "OUTPUT", "-j", cfg.Chain})
+	}
+	return rules
+}
+
+// LogPrefix marks the kernel log lines of egress that was not redirected.
+const LogPrefix = "pse egress: "
+
+// egressRules fill the filter chain of f, applying policy to what is not
+// exempt. Traffic redirected by the nat chain arrives here already addressed
+// to the proxy.
+func egressRules(cfg Config, f Family, proxy net.IP, policy Egress) []Rule {
+	ret := func(match ...string) Rule {
+		return append(append(Rule{"-t", "filter", "-A", cfg.Chain}, match...), "-j", "RETURN")
+	}
+	rules := []Rule{
+		ret("-o", "lo"),
+		ret("-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED"),
+	}
+	if proxy != nil {
+		ports := []int{cfg.ProxyPort}
+		if cfg.SMBPort != 0 {
+			ports = append(ports, cfg.SMBRelayPort)
+		}
+		for _, port := range ports {
+			rules = append(rules, ret("-d", proxy.String(), "-p", "tcp", "-m", "tcp", "--dport", strconv.Itoa(port)))
+		}
+	}
+	for _, proto := range []string{"udp", "tcp"} {
+		for _, ip := range cfg.DNS {
+			if f.Has(ip) {
+				rules = append(rules, ret("-d", ip.String(), "-p", proto, "-m", proto, "--dport", "53"))
+			}
+		}
+	}
+	for _, dest := range cfg.Allow {
+		if inFamily(f, dest) {
+			rules = append(rules, ret("-d", dest))
+		}
+	}
+	rules = append(rules, Rule{"-t", "filter", "-A", cfg.Chain, "-m", "limit", "--limit", "10/second",
+		"-j", "LOG", "--log-prefix", LogPrefix})
+	if policy == EgressReject {
+		rules = append(rules,
+			Rule{"-t", "filter", "-A", cfg.Chain, "-p", "tcp", "-j", "REJECT", "--reject-with", "tcp-reset"},
+			Rule{"-t", "filter", "-A", cfg.Chain, "-j", "REJECT"},
+		)
+	}
+	return rules
+}
+
+// inFamily reports whether the address or CIDR block dest belongs to f.
+// Host names are left to the binary to resolve in its own family.
+func inFamily(f Family, dest string) bool {
+	if ip, _, err := net.ParseCIDR(dest); err == nil {
+		return f.Has(ip)
+	}
+	if ip := net.ParseIP(dest); ip != nil {
+		return f.Has(ip)
+	}
+	return true
+}
+
+// natTeardown removes the nat chain and its jump.
+func natTeardown(cfg Config, st State) []Rule {
+	var rules []Rule
+	if st.JumpExists {
+		rules = append(rules, Rule{"-t", "nat", "-D", "OUTPUT", "-j", cfg.Chain})
+	}
+	if st.ChainExists {
+		rules = append(rules, Rule{"-t", "nat", "-F", cfg.Chain}, Rule{"-t", "nat", "-X", cfg.Chain})
+	}
+	return rules
+}
+
+// filterTeardown removes the filter chain and its jump.
+func filterTeardown(cfg Config, st State) []Rule {
+	var rules []Rule
+	if st.FilterJumpExists {
+		rules = append(rules, Rule{"-t", "filter", "-D", "OUTPUT", "-j", cfg.Chain})
+	}
+	if st.FilterChainExists {
+		rules = append(rules, Rule{"-t", "filter", "-F", cfg.Chain}, Rule{"-t", "filter", "-X", cfg.Chain})
+	}
+	return rules
+}
+
+// Runner executes iptables or ip6tables.
+type Runner interface {
+	Run(args ...string) error
+}
+
+// Exec runs the binary found at Path, iptables if empty.
+type Exec struct {
+	Path   string
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Run implements Runner.
+func (e Exec) Run(args ...string) error {
+	path := e.Path
+	if path == "" {
+		path = "iptables"
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = e.Stdout
+	cmd.Stderr = e.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %v: %w", path, args, err)
+	}
+	return nil
+}
+
+// Probe inspects the nat and filter tables for the chain and the OUTPUT
+// jump to it.
+func Probe(r Runner, chain string) State {
+	return State{
+		ChainExists:       r.Run("-t", "nat", "-n", "-L", chain) == nil,
+		JumpExists:        r.Run("-t", "nat", "-C", "OUTPUT", "-j", chain) == nil,
+		FilterChainExists: r.Run("-t", "filter", "-n", "-L", chain) == nil,
+		FilterJumpExists:  r.Run("-t", "filter", "-C", "OUTPUT", "-j", chain) == nil,
+	}
+}
+
+// Apply runs rules in order, stopping at the first failure.
+func Apply(r Runner, rules []Rule) error {
+	for _, rule := range rules {
+		if err := r.Run(rule...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Available reports whether r can manage the nat and filter tables of its
+// family; the IPv6 ones are missing on hosts without IPv6, and the nat table
+// on kernels without IPv6 NAT.
+func Available(r Runner) bool {
+	return r.Run("-t", "nat", "-n", "-L", "OUTPUT") == nil && r.Run("-t", "filter", "-n", "-L", "OUTPUT") == nil
+}
+
+// TeardownRules returns the invocations that remove everything SetupRules
+// installed in one family.
+func TeardownRules(cfg Config, st State) []Rule {
+	return append(natTeardown(cfg, st), filterTeardown(cfg, st)...)
+}
@@ -0,0 +1,232 @@
+package iptables
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupRulesFresh(t *testing.T) {
+	cfg := DefaultConfig(net.ParseIP("172.18.0.2"), nil)
+	rules := SetupRules(cfg, IPv4, State{})
+	require.Equal(t, []Rule{
+		{"-t", "nat", "-N", "pse"},
+		{"-t", "nat", "-A", "OUTPUT", "-j", "pse"},
+		{"-t", "nat", "-A", "pse", "-p", "tcp", "-m", "tcp", "--dport", "80", "-j", "DNAT", "--to-destination", "172.18.0.2:12345"},
+		{"-t", "nat", "-A", "pse", "-p", "tcp", "-m", "tcp", "--dport", "443", "-j", "DNAT", "--to-destination", "172.18.0.2:12345"},
+		{"-t", "filter", "-N", "pse"},
+		{"-t", "filter", "-A", "OUTPUT", "-j", "pse"},
+		{"-t", "filter", "-A", "pse", "-o", "lo", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-d", "172.18.0.2", "-p", "tcp", "-m", "tcp", "--dport", "12345", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-m", "limit", "--limit", "10/second", "-j", "LOG", "--log-prefix", "pse egress: "},
+	}, rules)
+}
+
+func TestSetupRulesExisting(t *testing.T) {
+	cfg := DefaultConfig(net.ParseIP("172.18.0.2"), nil)
+	cfg.Ports = []int{443}
+	cfg.Egress = EgressAllow
+	rules := SetupRules(cfg, IPv4, State{ChainExists: true, JumpExists: true})
+	require.Equal(t, []Rule{
+		{"-t", "nat", "-F", "pse"},
+		{"-t", "nat", "-A", "pse", "-p", "tcp", "-m", "tcp", "--dport", "443", "-j", "DNAT", "--to-destination", "172.18.0.2:12345"},
+	}, rules)
+}
+
+func TestSetupRulesSMB(t *testing.T) {
+	cfg := DefaultConfig(net.ParseIP("172.18.0.2"), net.ParseIP("fd00:18::2"))
+	cfg.SMBPort = 12446
+	for _, rules := range families(cfg) {
+		require.Contains(t, rules, Rule{"-t", "nat", "-A", "pse", "-p", "tcp", "-m", "tcp", "--dport", "445", "-j", "REDIRECT", "--to-ports", "12446"})
+	}
+	rules := SetupRules(cfg, IPv4, State{})
+	require.Contains(t, rules, Rule{"-t", "filter", "-A", "pse", "-d", "172.18.0.2", "-p", "tcp", "-m", "tcp", "--dport", "12445", "-j", "RETURN"})
+}
+
+func TestSetupRulesReject(t *testing.T) {
+	cfg := DefaultConfig(net.ParseIP("172.18.0.2"), nil)
+	cfg.Egress = EgressReject
+	cfg.DNS = []net.IP{net.ParseIP("168.63.129.16"), net.ParseIP("fd00::53")}
+	cfg.Allow = []string{"10.1.0.0/16"}
+	rules := SetupRules(cfg, IPv4, State{ChainExists: true, JumpExists: true, FilterChainExists: true, FilterJumpExists: true})
+	require.Equal(t, []Rule{
+		{"-t", "filter", "-F", "pse"},
+		{"-t", "filter", "-A", "pse", "-o", "lo", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-d", "172.18.0.2", "-p", "tcp", "-m", "tcp", "--dport", "12345", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-d", "168.63.129.16", "-p", "udp", "-m", "udp", "--dport", "53", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-d", "168.63.129.16", "-p", "tcp", "-m", "tcp", "--dport", "53", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-d", "10.1.0.0/16", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-m", "limit", "--limit", "10/second", "-j", "LOG", "--log-prefix", "pse egress: "},
+		{"-t", "filter", "-A", "pse", "-p", "tcp", "-j", "REJECT", "--reject-with", "tcp-reset"},
+		{"-t", "filter", "-A", "pse", "-j", "REJECT"},
+	}, rules[3:])
+}
+
+func TestSetupRulesAllowRemovesFilter(t *testing.T) {
+	cfg := DefaultConfig(net.ParseIP("172.18.0.2"), nil)
+	cfg.Egress = EgressAllow
+	rules := SetupRules(cfg, IPv4, State{ChainExists: true, JumpExists: true, FilterChainExists: true, FilterJumpExists: true})
+	require.Equal(t, []Rule{
+		{"-t", "filter", "-D", "OUTPUT", "-j", "pse"},
+		{"-t", "filter", "-F", "pse"},
+		{"-t", "filter", "-X", "pse"},
+	}, rules[3:])
+}
+
+// families returns the rule sets of both families for a fresh host.
+func families(cfg Config) map[Family][]Rule {
+	return map[Family][]Rule{
+		IPv4: SetupRules(cfg, IPv4, State{}),
+		IPv6: SetupRules(cfg, IPv6, State{}),
+	}
+}
+
+func TestSetupRulesDualStack(t *testing.T) {
+	cfg := DefaultConfig(net.ParseIP("172.18.0.2"), net.ParseIP("fd00:18::2"))
+	cfg.Egress = EgressReject
+	cfg.DNS = []net.IP{net.ParseIP("10.255.255.53"), net.ParseIP("fd00::53")}
+	cfg.Allow = []string{"10.1.0.0/16", "2001:db8::/32", "mirror.corp.example"}
+	rules := families(cfg)
+	require.Equal(t, []Rule{
+		{"-t", "nat", "-N", "pse"},
+		{"-t", "nat", "-A", "OUTPUT", "-j", "pse"},
+		{"-t", "nat", "-A", "pse", "-p", "tcp", "-m", "tcp", "--dport", "80", "-j", "DNAT", "--to-destination", "[fd00:18::2]:12345"},
+		{"-t", "nat", "-A", "pse", "-p", "tcp", "-m", "tcp", "--dport", "443", "-j", "DNAT", "--to-destination", "[fd00:18::2]:12345"},
+		{"-t", "filter", "-N", "pse"},
+		{"-t", "filter", "-A", "OUTPUT", "-j", "pse"},
+		{"-t", "filter", "-A", "pse", "-o", "lo", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-d", "fd00:18::2", "-p", "tcp", "-m", "tcp", "--dport", "12345", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-d", "fd00::53", "-p", "udp", "-m", "udp", "--dport", "53", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-d", "fd00::53", "-p", "tcp", "-m", "tcp", "--dport", "53", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-d", "2001:db8::/32", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-d", "mirror.corp.example", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-m", "limit", "--limit", "10/second", "-j", "LOG", "--log-prefix", "pse egress: "},
+		{"-t", "filter", "-A", "pse", "-p", "tcp", "-j", "REJECT", "--reject-with", "tcp-reset"},
+		{"-t", "filter", "-A", "pse", "-j", "REJECT"},
+	}, rules[IPv6])
+	require.Contains(t, rules[IPv4], Rule{"-t", "nat", "-A", "pse", "-p", "tcp", "-m", "tcp", "--dport", "443", "-j", "DNAT", "--to-destination", "172.18.0.2:12345"})
+	require.Contains(t, rules[IPv4], Rule{"-t", "filter", "-A", "pse", "-d", "10.1.0.0/16", "-j", "RETURN"})
+	require.NotContains(t, rules[IPv4], Rule{"-t", "filter", "-A", "pse", "-d", "2001:db8::/32", "-j", "RETURN"})
+}
+
+func TestSetupRulesIPv4Only(t *testing.T) {
+	cfg := DefaultConfig(net.ParseIP("172.18.0.2"), nil)
+	cfg.DNS = []net.IP{net.ParseIP("10.255.255.53")}
+	rules := families(cfg)
+	require.Equal(t, []Rule{
+		{"-t", "nat", "-N", "pse"},
+		{"-t", "nat", "-A", "OUTPUT", "-j", "pse"},
+		{"-t", "nat", "-A", "pse", "-p", "tcp", "-m", "tcp", "--dport", "80", "-j", "DNAT", "--to-destination", "172.18.0.2:12345"},
+		{"-t", "nat", "-A", "pse", "-p", "tcp", "-m", "tcp", "--dport", "443", "-j", "DNAT", "--to-destination", "172.18.0.2:12345"},
+		{"-t", "filter", "-N", "pse"},
+		{"-t", "filter", "-A", "OUTPUT", "-j", "pse"},
+		{"-t", "filter", "-A", "pse", "-o", "lo", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-d", "172.18.0.2", "-p", "tcp", "-m", "tcp", "--dport", "12345", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-d", "10.255.255.53", "-p", "udp", "-m", "udp", "--dport", "53", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-d", "10.255.255.53", "-p", "tcp", "-m", "tcp", "--dport", "53", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-m", "limit", "--limit", "10/second", "-j", "LOG", "--log-prefix", "pse egress: "},
+	}, rules[IPv4])
+	// Whatever the egress policy, IPv6 cannot reach the proxy and is
+	// rejected; the IPv4 name server does not open port 53.
+	require.Equal(t, []Rule{
+		{"-t", "filter", "-N", "pse"},
+		{"-t", "filter", "-A", "OUTPUT", "-j", "pse"},
+		{"-t", "filter", "-A", "pse", "-o", "lo", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-m", "limit", "--limit", "10/second", "-j", "LOG", "--log-prefix", "pse egress: "},
+		{"-t", "filter", "-A", "pse", "-p", "tcp", "-j", "REJECT", "--reject-with", "tcp-reset"},
+		{"-t", "filter", "-A", "pse", "-j", "REJECT"},
+	}, rules[IPv6])
+}
+
+func TestSetupRulesIPv6Only(t *testing.T) {
+	cfg := DefaultConfig(nil, net.ParseIP("fd00:18::2"))
+	cfg.Egress = EgressAllow
+	rules := families(cfg)
+	require.Equal(t, []Rule{
+		{"-t", "nat", "-N", "pse"},
+		{"-t", "nat", "-A", "OUTPUT", "-j", "pse"},
+		{"-t", "nat", "-A", "pse", "-p", "tcp", "-m", "tcp", "--dport", "80", "-j", "DNAT", "--to-destination", "[fd00:18::2]:12345"},
+		{"-t", "nat", "-A", "pse", "-p", "tcp", "-m", "tcp", "--dport", "443", "-j", "DNAT", "--to-destination", "[fd00:18::2]:12345"},
+	}, rules[IPv6])
+	require.Equal(t, []Rule{
+		{"-t", "filter", "-N", "pse"},
+		{"-t", "filter", "-A", "OUTPUT", "-j", "pse"},
+		{"-t", "filter", "-A", "pse", "-o", "lo", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "RETURN"},
+		{"-t", "filter", "-A", "pse", "-m", "limit", "--limit", "10/second", "-j", "LOG", "--log-prefix", "pse egress: "},
+		{"-t", "filter", "-A", "pse", "-p", "tcp", "-j", "REJECT", "--reject-with", "tcp-reset"},
+		{"-t", "filter", "-A", "pse", "-j", "REJECT"},
+	}, rules[IPv4])
+}
+
+func TestSetupRulesBlockRemovesRedirect(t *testing.T) {
+	cfg := DefaultConfig(nil, net.ParseIP("fd00:18::2"))
+	rules := SetupRules(cfg, IPv4, State{ChainExists: true, JumpExists: true, FilterChainExists: true, FilterJumpExists: true})
+	require.Equal(t, []Rule{
+		{"-t", "nat", "-D", "OUTPUT", "-j", "pse"},
+		{"-t", "nat", "-F", "pse"},
+		{"-t", "nat", "-X", "pse"},
+		{"-t", "filter", "-F", "pse"},
+	}, rules[:4])
+}
+
+func TestParseEgress(t *testing.T) {
+	e, err := ParseEgress("reject")
+	require.NoError(t, err)
+	require.Equal(t, EgressReject, e)
+	_, err = ParseEgress("drop")
+	require.EqualError(t, err, `iptables: unknown egress policy "drop", want allow, log or reject`)
+}
+
+type fakeRunner struct {
+	calls []string
+	fail  map[string]bool
+}
+
+func (f *fakeRunner) Run(args ...string) error {
+	call := strings.Join(args, " ")
+	f.calls = append(f.calls, call)
+	if f.fail[call] {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func TestAvailable(t *testing.T) {
+	require.True(t, Available(&fakeRunner{}))
+	require.False(t, Available(&fakeRunner{fail: map[string]bool{"-t filter -n -L OUTPUT": true}}))
+	require.False(t, Available(&fakeRunner{fail: map[string]bool{"-t nat -n -L OUTPUT": true}}))
+}
+
+func TestProbe(t *testing.T) {
+	r := &fakeRunner{fail: map[string]bool{"-t nat -C OUTPUT -j pse": true, "-t filter -n -L pse": true, "-t filter -C OUTPUT -j pse": true}}
+	require.Equal(t, State{ChainExists: true}, Probe(r, "pse"))
+}
+
+func TestApplyStopsOnError(t *testing.T) {
+	r := &fakeRunner{fail: map[string]bool{"-t nat -N pse": true}}
+	err := Apply(r, SetupRules(DefaultConfig(net.ParseIP("10.0.0.1"), nil), IPv4, State{}))
+	require.Error(t, err)
+	require.Len(t, r.calls, 1)
+}
+
+func TestTeardownRules(t *testing.T) {
+	cfg := DefaultConfig(nil, nil)
+	require.Equal(t, []Rule{
+		{"-t", "nat", "-D", "OUTPUT", "-j", "pse"},
+		{"-t", "nat", "-F", "pse"},
+		{"-t", "nat", "-X", "pse"},
+		{"-t", "filter", "-D", "OUTPUT", "-j", "pse"},
+		{"-t", "filter", "-F", "pse"},
+		{"-t", "filter", "-X", "pse"},
+	}, TeardownRules(cfg, State{ChainExists: true, JumpExists: true, FilterChainExists: true, FilterJumpExists: true}))
+	require.Empty(t, TeardownRules(cfg, State{}))
+}
@@ -4,17 +4,30 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/hirochachacha/go-smb2"
 	"github.com/spf13/cobra"
+	"inivisirisk.com/demo/demo/pse"
 )
 
 var rootCmd = &cobra.Command{
-	Use: "test",
-	Run: func(cmd *cobra.Command, args []string) {
-		_ = &smb2.Dialer{}
+	Use:   "pse",
+	Short: "Pipeline Security Engine build helper",
+	Long: `Pipeline Security Engine build helper.
 
-		// Do Stuff Here
-	},
+Without a command, pse attempts an SMB2 session and mounts a share, to show
+that SMB egress is detected.`,
+	// main prints the error.
+	SilenceErrors: true,
+	RunE:          smbDemo,
+}
+
+var (
+	statePath string
+	pseURL    string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&statePath, "state", defaultStatePath, "file recording the changes made by setup")
+	rootCmd.PersistentFlags().StringVar(&pseURL, "url", pse.DefaultBaseURL, "base URL of the PSE service")
 }
 
 func main() {
@@ -0,0 +1,186 @@
+// Package mock is a local stand-in for the PSE control API. It serves a
+// generated CA on /ca, records the sessions opened by /start and closed by
+// /end, and exposes them on /sessions for tests to inspect.
+package mock
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"inivisirisk.com/demo/demo/ca"
+	"inivisirisk.com/demo/demo/pse"
+)
+
+// Session is one build as seen by the server.
+type Session struct {
+	pse.BuildInfo
+	Status  string     `json:"status,omitempty"`
+	Started time.Time  `json:"started"`
+	Ended   *time.Time `json:"ended,omitempty"`
+}
+
+// Server implements the PSE control API.
+type Server struct {
+	CA *ca.Authority
+	// Path, if set, is the JSON file sessions are persisted to.
+	Path string
+
+	mu       sync.Mutex
+	sessions []*Session
+	now      func() time.Time
+}
+
+// NewServer returns a server for the given CA, loading previously recorded
+// sessions from path.
+func NewServer(authority *ca.Authority, path string) (*Server, error) {
+	s := &Server{CA: authority, Path: path, now: time.Now}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.sessions); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Handler returns the HTTP handler of the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ca", s.handleCA)
+	mux.HandleFunc("/start", s.handleStart)
+	mux.HandleFunc("/end", s.handleEnd)
+	mux.HandleFunc("/sessions", s.handleSessions)
+	return mux
+}
+
+// Sessions returns the recorded sessions matching every non-empty field of
+// filter.
+func (s *Server) Sessions(filter pse.BuildInfo) []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Session
+	for _, sess := range s.sessions {
+		if match(sess.BuildInfo, filter) {
+			out = append(out, *sess)
+		}
+	}
+	return out
+}
+
+func (s *Server) handleCA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(s.CA.CertPEM())
+}
+
+func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
+	form, ok := postForm(w, r)
+	if !ok {
+		return
+	}
+	info := pse.ParseBuildInfo(form)
+	if info.BuildURL == "" {
+		http.Error(w, "missing build_url", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := append(s.sessions[:len(s.sessions):len(s.sessions)], &Session{BuildInfo: info, Started: s.now()})
+	if s.persist(w, sessions) {
+		s.sessions = sessions
+	}
+}
+
+func (s *Server) handleEnd(w http.ResponseWriter, r *http.Request) {
+	form, ok := postForm(w, r)
+	if !ok {
+		return
+	}
+	res := pse.ParseBuildResult(form)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A build may have been restarted with the same URL, close the latest.
+	for i := len(s.sessions) - 1; i >= 0; i-- {
+		sess := s.sessions[i]
+		if sess.BuildURL == res.BuildURL && sess.Ended == nil {
+			now := s.now()
+			ended := *sess
+			ended.Ended, ended.Status = &now, res.Status
+			sessions := append([]*Session(nil), s.sessions...)
+			sessions[i] = &ended
+			if s.persist(w, sessions) {
+				s.sessions = sessions
+			}
+			return
+		}
+	}
+	http.Error(w, "no open session for "+res.BuildURL, http.StatusNotFound)
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	filter := pse.ParseBuildInfo(r.URL.Query())
+	sessions := s.Sessions(filter)
+	if sessions == nil {
+		sessions = []Session{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// persist writes the sessions to Path. s.mu must be held.
+// persist writes sessions to Path and reports whether they may replace the
+// recorded ones, answering w with the error if not. A request that failed
+// leaves no trace, so a retry does not record a session twice.
+func (s *Server) persist(w http.ResponseWriter, sessions []*Session) bool {
+	if s.Path == "" {
+		return true
+	}
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err == nil {
+		err = os.WriteFile(s.Path, data, 0o644)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func postForm(w http.ResponseWriter, r *http.Request) (url.Values, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return r.PostForm, true
+}
+
+func match(info, filter pse.BuildInfo) bool {
+	got, want := info.Form(), filter.Form()
+	for k := range want {
+		if v := want.Get(k); v != "" && got.Get(k) != v {
+			return false
+		}
+	}
+	return true
+}
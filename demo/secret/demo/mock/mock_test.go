@@ -0,0 +1,94 @@
+package mock
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/ca"
+	"inivisirisk.com/demo/demo/pse"
+)
+
+func TestSessionFlow(t *testing.T) {
+	authority, err := ca.New("PSE Mock CA")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	srv, err := NewServer(authority, path)
+	require.NoError(t, err)
+
+	leaf, err := authority.Leaf("127.0.0.1")
+	require.NoError(t, err)
+	ts := httptest.NewUnstartedServer(srv.Handler())
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{*leaf}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	ctx := context.Background()
+	client := pse.NewClient(ts.URL)
+	pem, err := client.FetchCA(ctx)
+	require.NoError(t, err)
+	require.Equal(t, authority.CertPEM(), pem)
+
+	info := pse.BuildInfo{Builder: "jenkins", BuildURL: "https://ci/job/1/", Project: "demo", SCM: "git"}
+	require.NoError(t, client.Start(ctx, info))
+	require.NoError(t, client.Start(ctx, pse.BuildInfo{Builder: "github", BuildURL: "https://gh/run/2"}))
+	require.NoError(t, client.End(ctx, pse.BuildResult{BuildURL: info.BuildURL, Status: "success"}))
+
+	client.Retries = 0
+	err = client.End(ctx, pse.BuildResult{BuildURL: "https://unknown"})
+	require.Error(t, err)
+
+	resp, err := client.HTTPClient.Get(ts.URL + "/sessions?builder=jenkins")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var sessions []Session
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&sessions))
+	require.Len(t, sessions, 1)
+	require.Equal(t, info, sessions[0].BuildInfo)
+	require.Equal(t, "success", sessions[0].Status)
+	require.NotNil(t, sessions[0].Ended)
+
+	reloaded, err := NewServer(authority, path)
+	require.NoError(t, err)
+	require.Len(t, reloaded.Sessions(pse.BuildInfo{}), 2)
+}
+
+func TestStartRequiresBuildURL(t *testing.T) {
+	authority, err := ca.New("PSE Mock CA")
+	require.NoError(t, err)
+	srv, err := NewServer(authority, "")
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/start", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestPersistFailureRecordsNothing(t *testing.T) {
+	authority, err := ca.New("PSE Mock CA")
+	require.NoError(t, err)
+	srv, err := NewServer(authority, "")
+	require.NoError(t, err)
+	post := func(endpoint string, form url.Values) int {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		srv.Handler().ServeHTTP(rec, r)
+		return rec.Code
+	}
+	require.Equal(t, http.StatusOK, post("/start", pse.BuildInfo{BuildURL: "https://ci/job/1/"}.Form()))
+
+	// Sessions cannot be written into a missing directory.
+	srv.Path = filepath.Join(t.TempDir(), "missing", "sessions.json")
+	require.Equal(t, http.StatusInternalServerError, post("/start", pse.BuildInfo{BuildURL: "https://ci/job/2/"}.Form()))
+	require.Equal(t, http.StatusInternalServerError, post("/end", pse.BuildResult{BuildURL: "https://ci/job/1/", Status: "success"}.Form()))
+	sessions := srv.Sessions(pse.BuildInfo{})
+	require.Len(t, sessions, 1)
+	require.Nil(t, sessions[0].Ended)
+}
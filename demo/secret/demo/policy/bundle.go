@@ -0,0 +1,70 @@
+package policy
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Open returns a directory holding the policy at path, which is either a
+// directory or a, possibly gzipped, tarball. Tarballs are extracted to a
+// temporary directory removed by cleanup.
+func Open(path string) (dir string, cleanup func(), err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	if fi.IsDir() {
+		return path, func() {}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	return extractTemp(f)
+}
+
+// Unpack normalizes a tarball held in memory, such as one whose signature
+// has just been verified, and extracts it to a temporary directory removed
+// by cleanup.
+func Unpack(tarball []byte) (dir string, cleanup func(), err error) {
+	var buf bytes.Buffer
+	if err := Normalize(bytes.NewReader(tarball), &buf); err != nil {
+		return "", nil, err
+	}
+	return extractTemp(&buf)
+}
+
+func extractTemp(r io.Reader) (dir string, cleanup func(), err error) {
+	dir, err = os.MkdirTemp("", "pse-policy-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	if err := Extract(r, dir); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
+
+// Extract unpacks the regular files of a tarball, gzipped or not, into dir.
+func Extract(r io.Reader, dir string) error {
+	return walkTar(r, func(name string, body io.Reader) error {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, body)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+}
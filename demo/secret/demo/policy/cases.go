@@ -0,0 +1,172 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Case is a recorded event with the decision the policy must return. Cases
+// are stored one per JSON file.
+type Case struct {
+	Name string `json:"name,omitempty"`
+	// Package is the policy package, the type of Input if empty.
+	Package string          `json:"package,omitempty"`
+	Input   json.RawMessage `json:"input"`
+	// Expect is the wanted decision. Details are only compared if set.
+	Expect Decision `json:"expect"`
+}
+
+// LoadCases reads every *.json file in dir. Cases are named after their file
+// unless they set a name.
+func LoadCases(dir string) ([]Case, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	cases := make([]Case, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var c Case
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("policy: case %s: %w", file, err)
+		}
+		if c.Name == "" {
+			c.Name = strings.TrimSuffix(filepath.Base(file), ".json")
+		}
+		if err := c.Expect.Validate(); err != nil {
+			return nil, fmt.Errorf("policy: case %s: %w", file, err)
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+func (c *Case) pkg() (string, error) {
+	if c.Package != "" {
+		return c.Package, nil
+	}
+	var ev struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(c.Input, &ev); err != nil || ev.Type == "" {
+		return "", fmt.Errorf("policy: case %s has no package and its input no type", c.Name)
+	}
+	return ev.Type, nil
+}
+
+// CaseResult is the outcome of one case.
+type CaseResult struct {
+	Case     Case
+	Got      *Decision
+	Err      error
+	Diff     string
+	Duration time.Duration
+}
+
+// Passed reports whether the policy returned the expected decision.
+func (r *CaseResult) Passed() bool {
+	return r.Err == nil && r.Diff == ""
+}
+
+// Run evaluates every case.
+func Run(ctx context.Context, ev Evaluator, cases []Case) []CaseResult {
+	results := make([]CaseResult, len(cases))
+	for i, c := range cases {
+		start := time.Now()
+		res := CaseResult{Case: c}
+		if pkg, err := c.pkg(); err != nil {
+			res.Err = err
+		} else if res.Got, res.Err = ev.Eval(ctx, pkg, c.Input); res.Err == nil {
+			res.Diff = diff(c.Expect, *res.Got)
+		}
+		res.Duration = time.Since(start)
+		results[i] = res
+	}
+	return results
+}
+
+func diff(want, got Decision) string {
+	var lines []string
+	if want.Result != got.Result {
+		lines = append(lines, fmt.Sprintf("result: want %q, got %q", want.Result, got.Result))
+	}
+	if want.Details != "" && want.Details != got.Details {
+		lines = append(lines, fmt.Sprintf("details: want %q, got %q", want.Details, got.Details))
+	}
+	return strings.Join(lines, "\n")
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes results as a JUnit XML report.
+func WriteJUnit(w io.Writer, suite string, results []CaseResult) error {
+	s := junitSuite{Name: suite, Tests: len(results)}
+	var total time.Duration
+	for _, r := range results {
+		total += r.Duration
+		pkg, _ := r.Case.pkg()
+		jc := junitCase{Name: r.Case.Name, Classname: pkg, Time: seconds(r.Duration)}
+		switch {
+		case r.Err != nil:
+			s.Errors++
+			jc.Error = &junitMessage{Message: r.Err.Error()}
+		case r.Diff != "":
+			s.Failures++
+			jc.Failure = &junitMessage{Message: "unexpected decision", Text: r.Diff}
+		}
+		s.Cases = append(s.Cases, jc)
+	}
+	s.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{s}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
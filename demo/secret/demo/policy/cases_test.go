@@ -0,0 +1,69 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stub decides like testdata/bundle without needing opa.
+var stub = EvalFunc(func(ctx context.Context, pkg string, input []byte) (*Decision, error) {
+	var ev struct {
+		Action  string `json:"action"`
+		Details struct {
+			Repo  string `json:"repo"`
+			Force bool   `json:"force"`
+		} `json:"details"`
+	}
+	json.Unmarshal(input, &ev)
+	switch {
+	case pkg == "web":
+		return &Decision{Result: "alert/crit"}, nil
+	case ev.Action == "push" && ev.Details.Force:
+		return &Decision{Result: "alert/crit", Details: "force push to " + ev.Details.Repo}, nil
+	case ev.Action == "pull" && ev.Details.Repo == "github.com/invisirisk-demo/app":
+		return &Decision{Result: "allow"}, nil
+	default:
+		return &Decision{Result: "alert/warn", Details: "accessing repo " + ev.Details.Repo + " with action " + ev.Action}, nil
+	}
+})
+
+func TestLoadCases(t *testing.T) {
+	cases, err := LoadCases("testdata/cases")
+	require.NoError(t, err)
+	require.Len(t, cases, 5)
+	require.Equal(t, "gettorbrowser-pull", cases[0].Name)
+	require.Equal(t, "git-force-push-demo", cases[1].Name)
+	require.Equal(t, "web post to risky.com", cases[4].Name)
+}
+
+func TestRun(t *testing.T) {
+	cases, err := LoadCases("testdata/cases")
+	require.NoError(t, err)
+	for _, res := range Run(context.Background(), stub, cases) {
+		require.True(t, res.Passed(), "%s: %v %s", res.Case.Name, res.Err, res.Diff)
+	}
+
+	wrong := EvalFunc(func(ctx context.Context, pkg string, input []byte) (*Decision, error) {
+		if pkg == "web" {
+			return nil, errors.New("opa failed")
+		}
+		return &Decision{Result: "deny", Details: "Blocked by policy"}, nil
+	})
+	results := Run(context.Background(), wrong, cases)
+	require.Equal(t, `result: want "alert/warn", got "deny"
+details: want "accessing repo github.com/TheTorProject/gettorbrowser with action pull", got "Blocked by policy"`, results[0].Diff)
+	require.Equal(t, `result: want "allow", got "deny"`, results[3].Diff)
+	require.EqualError(t, results[4].Err, "opa failed")
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteJUnit(&buf, "policy", results))
+	out := buf.String()
+	require.Contains(t, out, `<testsuite name="policy" tests="5" failures="4" errors="1"`)
+	require.Contains(t, out, `<testcase name="invisirisk-demo-pull" classname="git"`)
+	require.Contains(t, out, `<error message="opa failed"></error>`)
+}
@@ -0,0 +1,336 @@
+package policy
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxSize bounds the size of a fetched policy tarball.
+const DefaultMaxSize = 10 << 20
+
+// maxUnpackedSize bounds the decompressed size of a policy tarball, so that
+// a small tarball cannot unpack to fill memory or disk.
+var maxUnpackedSize int64 = 64 << 20
+
+// githubDir matches the top-level directory of GitHub repository tarballs,
+// owner-repo-shortsha.
+var githubDir = regexp.MustCompile(`^[A-Za-z0-9_.-]+-[0-9a-f]{7,40}/$`)
+
+// Fetcher downloads a policy tarball the way the PSE service does: from
+// POLICY_URL with POLICY_AUTH_TOKEN as bearer token.
+type Fetcher struct {
+	URL   string
+	Token string
+	// Client defaults to http.DefaultClient, which drops the token when
+	// GitHub redirects the tarball download to codeload.github.com.
+	Client *http.Client
+	// MaxSize defaults to DefaultMaxSize.
+	MaxSize int64
+	// CacheDir, if set, keeps the last tarball and its ETag so that an
+	// unchanged policy is not downloaded again.
+	CacheDir string
+	// PublicKey, if set, is the PEM key the tarball must be signed with,
+	// see FetchSigned. The signature is downloaded from SignatureURL.
+	PublicKey    []byte
+	SignatureURL string
+}
+
+// Fetch downloads the policy and returns it as a normalized bundle, see
+// Normalize. cached reports whether the server said the cached copy is
+// current.
+func (f *Fetcher) Fetch(ctx context.Context) (bundle []byte, cached bool, err error) {
+	if f.PublicKey != nil {
+		return nil, false, errors.New("policy: a public key is configured, fetch the policy with FetchSigned")
+	}
+	etagFile, tarFile := filepath.Join(f.CacheDir, "etag"), filepath.Join(f.CacheDir, "policy.tar.gz")
+	var etag string
+	if f.CacheDir != "" {
+		if data, err := os.ReadFile(etagFile); err == nil {
+			etag = strings.TrimSpace(string(data))
+		}
+	}
+	resp, raw, err := f.get(ctx, etag)
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		if data, err := os.ReadFile(tarFile); err == nil {
+			return data, true, nil
+		}
+		return nil, false, fmt.Errorf("policy: %s not modified but no cached copy in %s", f.URL, f.CacheDir)
+	}
+
+	var buf bytes.Buffer
+	if err := Normalize(bytes.NewReader(raw), &buf); err != nil {
+		return nil, false, err
+	}
+	if f.CacheDir != "" {
+		if err := os.MkdirAll(f.CacheDir, 0o755); err != nil {
+			return nil, false, err
+		}
+		if err := os.WriteFile(tarFile, buf.Bytes(), 0o644); err != nil {
+			return nil, false, err
+		}
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			err = os.WriteFile(etagFile, []byte(etag), 0o644)
+		} else {
+			err = os.Remove(etagFile)
+			if errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return buf.Bytes(), false, nil
+}
+
+// FetchSigned downloads the policy and its signature and returns both once
+// the signature verifies against PublicKey. The tarball is returned as
+// served rather than normalized, since that is what the signature covers,
+// so it can be checked again with Verify wherever it is used. It is
+// downloaded every time rather than trusted from the cache.
+func (f *Fetcher) FetchSigned(ctx context.Context) (tarball, sig []byte, err error) {
+	if f.PublicKey == nil {
+		return nil, nil, errors.New("policy: no public key to verify the policy with")
+	}
+	if f.SignatureURL == "" {
+		return nil, nil, errors.New("policy: a public key is configured but no signature URL")
+	}
+	_, raw, err := f.get(ctx, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if sig, err = f.signature(ctx); err != nil {
+		return nil, nil, err
+	}
+	if err := Verify(raw, sig, f.PublicKey); err != nil {
+		return nil, nil, err
+	}
+	// Check that it is a policy at all before it is handed on.
+	if err := Normalize(bytes.NewReader(raw), io.Discard); err != nil {
+		return nil, nil, err
+	}
+	return raw, sig, nil
+}
+
+// get downloads the tarball at URL, bounded by MaxSize. With etag set, a
+// not modified response is returned without a body.
+func (f *Fetcher) get(ctx context.Context, etag string) (*http.Response, []byte, error) {
+	req, err := f.request(ctx, f.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("policy: fetching %s: %w", f.URL, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return nil, nil, fmt.Errorf("policy: fetching %s: %s, check the URL and that the token can read it", f.URL, resp.Status)
+	case http.StatusNotModified:
+		if etag != "" {
+			return resp, nil, nil
+		}
+		fallthrough
+	default:
+		return nil, nil, fmt.Errorf("policy: fetching %s: %s", f.URL, resp.Status)
+	}
+
+	max := f.MaxSize
+	if max <= 0 {
+		max = DefaultMaxSize
+	}
+	if resp.ContentLength > max {
+		return nil, nil, fmt.Errorf("policy: %s is %d bytes, more than the limit of %d", f.URL, resp.ContentLength, max)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(raw)) > max {
+		return nil, nil, fmt.Errorf("policy: %s is more than the limit of %d bytes", f.URL, max)
+	}
+	return resp, raw, nil
+}
+
+// signature downloads the signature at SignatureURL.
+func (f *Fetcher) signature(ctx context.Context) ([]byte, error) {
+	req, err := f.request(ctx, f.SignatureURL)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("policy: fetching signature %s: %w", f.SignatureURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("policy: fetching signature %s: %s", f.SignatureURL, resp.Status)
+	}
+	// A base64 signature is a few hundred bytes at most.
+	return io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+}
+
+// request builds a GET of target. The token is only sent to the scheme and
+// host of URL, not to a signature hosted elsewhere.
+func (f *Fetcher) request(ctx context.Context, target string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.Token != "" {
+		if u, err := url.Parse(f.URL); err == nil && u.Scheme == req.URL.Scheme && u.Host == req.URL.Host {
+			req.Header.Set("Authorization", "Bearer "+f.Token)
+		}
+	}
+	return req, nil
+}
+
+func (f *Fetcher) client() *http.Client {
+	if f.Client != nil {
+		return f.Client
+	}
+	return http.DefaultClient
+}
+
+// Normalize rewrites a policy tarball, gzipped or not, as a gzipped tarball
+// of its regular files in name order with fixed metadata, so that the same
+// policy always yields the same bytes. The single top-level directory GitHub
+// adds to repository tarballs (owner-repo-sha/) is removed; other top-level
+// directories are kept. The policy must contain at least one .rego file.
+func Normalize(r io.Reader, w io.Writer) error {
+	files := map[string][]byte{}
+	err := walkTar(r, func(name string, body io.Reader) error {
+		data, err := io.ReadAll(body)
+		files[name] = data
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	prefix := commonDir(names)
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	rego := false
+	for _, name := range names {
+		out := strings.TrimPrefix(name, prefix)
+		rego = rego || strings.HasSuffix(out, ".rego")
+		data := files[name]
+		hdr := &tar.Header{Name: out, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg, Format: tar.FormatPAX}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if !rego {
+		return errors.New("policy: bundle has no .rego files")
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// commonDir returns "dir/" if every name is inside the same top-level
+// directory and it is the one GitHub names after the repository and commit.
+func commonDir(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	first := strings.SplitN(names[0], "/", 2)
+	if len(first) < 2 {
+		return ""
+	}
+	prefix := first[0] + "/"
+	if !githubDir.MatchString(prefix) {
+		return ""
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			return ""
+		}
+	}
+	return prefix
+}
+
+// walkTar calls fn with the cleaned slash separated name and contents of
+// every regular file in a tarball, gzipped or not. It fails once the tarball
+// unpacks to more than maxUnpackedSize bytes.
+func walkTar(r io.Reader, fn func(name string, body io.Reader) error) error {
+	var head [2]byte
+	n, _ := io.ReadFull(r, head[:])
+	r = io.MultiReader(bytes.NewReader(head[:n]), r)
+	if n == 2 && head[0] == 0x1f && head[1] == 0x8b {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	tr := tar.NewReader(&limitReader{r: r, n: maxUnpackedSize})
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("policy: unsafe path %q in tarball", hdr.Name)
+		}
+		if err := fn(name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// limitReader fails once more than n bytes have been read from r.
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if l.n -= int64(n); l.n < 0 {
+		return n, fmt.Errorf("policy: tarball unpacks to more than %d bytes", maxUnpackedSize)
+	}
+	return n, err
+}
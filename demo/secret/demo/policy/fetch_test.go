@@ -0,0 +1,197 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func bundleFiles(t *testing.T, bundle []byte) map[string]string {
+	files := map[string]string{}
+	require.NoError(t, walkTar(bytes.NewReader(bundle), func(name string, body io.Reader) error {
+		data, err := io.ReadAll(body)
+		files[name] = string(data)
+		return err
+	}))
+	return files
+}
+
+func TestFetchGitHubTarball(t *testing.T) {
+	tgz := tarball(t, map[string]string{
+		"invisirisk-policy-1a2b3c4/git/git.rego": "package git",
+		"invisirisk-policy-1a2b3c4/web.rego":     "package web",
+		"invisirisk-policy-1a2b3c4/README.md":    "policy",
+	})
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(tgz)
+	}))
+	defer srv.Close()
+
+	f := &Fetcher{URL: srv.URL, Token: "secret", CacheDir: t.TempDir()}
+	bundle, cached, err := f.Fetch(context.Background())
+	require.NoError(t, err)
+	require.False(t, cached)
+	files := bundleFiles(t, bundle)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	require.Equal(t, []string{"README.md", "git/git.rego", "web.rego"}, names)
+
+	again, cached, err := f.Fetch(context.Background())
+	require.NoError(t, err)
+	require.True(t, cached)
+	require.Equal(t, bundle, again)
+	require.Equal(t, 2, requests)
+}
+
+func TestNormalizeDeterministic(t *testing.T) {
+	var a, b bytes.Buffer
+	require.NoError(t, Normalize(bytes.NewReader(tarball(t, map[string]string{"x/a.rego": "a", "x/b.rego": "b"})), &a))
+	require.NoError(t, Normalize(bytes.NewReader(tarball(t, map[string]string{"x/b.rego": "b", "x/a.rego": "a"})), &b))
+	require.Equal(t, a.Bytes(), b.Bytes())
+}
+
+func TestNormalizeKeepsMixedTopLevel(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Normalize(bytes.NewReader(tarball(t, map[string]string{"git/git.rego": "", "web/web.rego": ""})), &buf))
+	require.Contains(t, bundleFiles(t, buf.Bytes()), "git/git.rego")
+}
+
+func TestNormalizeKeepsOtherTopLevel(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Normalize(bytes.NewReader(tarball(t, map[string]string{"policy/git.rego": "", "policy/web.rego": ""})), &buf))
+	require.Contains(t, bundleFiles(t, buf.Bytes()), "policy/git.rego")
+}
+
+func TestNormalizeUnpackedSize(t *testing.T) {
+	defer func(max int64) { maxUnpackedSize = max }(maxUnpackedSize)
+	maxUnpackedSize = 64 << 10
+	tgz := tarball(t, map[string]string{"git.rego": strings.Repeat("#", 128<<10)})
+	require.Less(t, len(tgz), 1<<10)
+	err := Normalize(bytes.NewReader(tgz), io.Discard)
+	require.EqualError(t, err, "policy: tarball unpacks to more than 65536 bytes")
+}
+
+func TestNormalizeNoRego(t *testing.T) {
+	err := Normalize(bytes.NewReader(tarball(t, map[string]string{"repo/README.md": ""})), io.Discard)
+	require.EqualError(t, err, "policy: bundle has no .rego files")
+}
+
+func TestFetchErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		w.Write(bytes.Repeat([]byte("x"), 2048))
+	}))
+	defer srv.Close()
+
+	_, _, err := (&Fetcher{URL: srv.URL}).Fetch(context.Background())
+	require.ErrorContains(t, err, "404 Not Found, check the URL and that the token can read it")
+
+	_, _, err = (&Fetcher{URL: srv.URL, Token: "t", MaxSize: 1024}).Fetch(context.Background())
+	require.ErrorContains(t, err, "more than the limit of 1024")
+}
+
+func TestFetchSigned(t *testing.T) {
+	tgz := tarball(t, map[string]string{"repo-1a2b3c4/git.rego": "package git"})
+	pub, priv, err := GenerateKey()
+	require.NoError(t, err)
+	sig, err := Sign(tgz, priv)
+	require.NoError(t, err)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/policy.sig":
+			w.Write(sig)
+		case "/tampered.sig":
+			w.Write([]byte("bm90IHRoZSBzaWduYXR1cmU=\n"))
+		default:
+			require.Empty(t, r.Header.Get("If-None-Match"))
+			w.Header().Set("ETag", `"v1"`)
+			w.Write(tgz)
+		}
+	}))
+	defer srv.Close()
+
+	f := &Fetcher{URL: srv.URL + "/policy", CacheDir: t.TempDir(), PublicKey: pub, SignatureURL: srv.URL + "/policy.sig"}
+	got, gotSig, err := f.FetchSigned(context.Background())
+	require.NoError(t, err)
+	// The tarball is kept as served so that the signature still covers it.
+	require.Equal(t, tgz, got)
+	require.Equal(t, sig, gotSig)
+	// The cached copy is not trusted, the policy is downloaded again.
+	_, _, err = f.FetchSigned(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 4, requests)
+
+	_, _, err = f.Fetch(context.Background())
+	require.ErrorContains(t, err, "fetch the policy with FetchSigned")
+
+	f.SignatureURL = srv.URL + "/tampered.sig"
+	_, _, err = f.FetchSigned(context.Background())
+	require.ErrorIs(t, err, ErrBadSignature)
+
+	f.SignatureURL = ""
+	_, _, err = f.FetchSigned(context.Background())
+	require.EqualError(t, err, "policy: a public key is configured but no signature URL")
+}
+
+func TestFetchSignatureToken(t *testing.T) {
+	tgz := tarball(t, map[string]string{"git.rego": "package git"})
+	pub, priv, err := GenerateKey()
+	require.NoError(t, err)
+	sig, err := Sign(tgz, priv)
+	require.NoError(t, err)
+	auth := map[string]string{}
+	var mu sync.Mutex
+	handler := func(body []byte) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			auth[r.Host+r.URL.Path] = r.Header.Get("Authorization")
+			mu.Unlock()
+			w.Write(body)
+		})
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/policy", handler(tgz))
+	mux.Handle("/policy.sig", handler(sig))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	other := httptest.NewServer(handler(sig))
+	defer other.Close()
+
+	f := &Fetcher{URL: srv.URL + "/policy", Token: "secret", PublicKey: pub, SignatureURL: srv.URL + "/policy.sig"}
+	_, _, err = f.FetchSigned(context.Background())
+	require.NoError(t, err)
+	f.SignatureURL = other.URL + "/policy.sig"
+	_, _, err = f.FetchSigned(context.Background())
+	require.NoError(t, err)
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	require.Equal(t, map[string]string{
+		host + "/policy":     "Bearer secret",
+		host + "/policy.sig": "Bearer secret",
+		strings.TrimPrefix(other.URL, "http://") + "/policy.sig": "",
+	}, auth)
+}
@@ -0,0 +1,93 @@
+// Package policy evaluates PSE Rego policies locally. Every policy package
+// defines a decision object whose result is one of Results; alerts carry a
+// message in details.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Results are the decision results PSE understands.
+var Results = []string{"allow", "deny", "alert/warn", "alert/error", "alert/crit"}
+
+// Decision is what a policy returns for an event.
+type Decision struct {
+	Result  string `json:"result"`
+	Details string `json:"details,omitempty"`
+}
+
+// Validate checks that d uses a documented result.
+func (d *Decision) Validate() error {
+	for _, r := range Results {
+		if d.Result == r {
+			return nil
+		}
+	}
+	return fmt.Errorf("policy: invalid result %q, expected one of %s", d.Result, strings.Join(Results, ", "))
+}
+
+// Evaluator evaluates data.<pkg>.decision for an input event.
+type Evaluator interface {
+	Eval(ctx context.Context, pkg string, input []byte) (*Decision, error)
+}
+
+// EvalFunc adapts a function to Evaluator.
+type EvalFunc func(ctx context.Context, pkg string, input []byte) (*Decision, error)
+
+// Eval implements Evaluator.
+func (f EvalFunc) Eval(ctx context.Context, pkg string, input []byte) (*Decision, error) {
+	return f(ctx, pkg, input)
+}
+
+// OPA evaluates policies with the opa command line tool.
+type OPA struct {
+	// Path is the opa binary, found in PATH if empty.
+	Path string
+	// Dir holds the .rego and data files of the policy.
+	Dir string
+}
+
+// Eval implements Evaluator.
+func (o *OPA) Eval(ctx context.Context, pkg string, input []byte) (*Decision, error) {
+	path := o.Path
+	if path == "" {
+		path = "opa"
+	}
+	query := "data." + pkg + ".decision"
+	cmd := exec.CommandContext(ctx, path, "eval", "--format", "json", "--data", o.Dir, "--stdin-input", query)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("policy: opa eval %s: %w: %s", query, err, strings.TrimSpace(stderr.String()))
+	}
+	return parseEval(query, out)
+}
+
+// parseEval extracts the decision from the JSON output of opa eval.
+func parseEval(query string, out []byte) (*Decision, error) {
+	var res struct {
+		Result []struct {
+			Expressions []struct {
+				Value json.RawMessage `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, fmt.Errorf("policy: parsing opa output: %w", err)
+	}
+	if len(res.Result) == 0 || len(res.Result[0].Expressions) == 0 {
+		return nil, fmt.Errorf("policy: %s is undefined", query)
+	}
+	d := &Decision{}
+	if err := json.Unmarshal(res.Result[0].Expressions[0].Value, d); err != nil {
+		return nil, fmt.Errorf("policy: %s is not a decision object: %w", query, err)
+	}
+	return d, d.Validate()
+}
@@ -0,0 +1,100 @@
+package policy
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEval(t *testing.T) {
+	d, err := parseEval("data.git.decision", []byte(`{"result":[{"expressions":[{"value":{"result":"alert/warn","details":"accessing repo"},"text":"data.git.decision"}]}]}`))
+	require.NoError(t, err)
+	require.Equal(t, &Decision{Result: "alert/warn", Details: "accessing repo"}, d)
+
+	_, err = parseEval("data.git.decision", []byte(`{}`))
+	require.EqualError(t, err, "policy: data.git.decision is undefined")
+
+	_, err = parseEval("data.git.decision", []byte(`{"result":[{"expressions":[{"value":{"result":"block"}}]}]}`))
+	require.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	for _, r := range Results {
+		require.NoError(t, (&Decision{Result: r}).Validate())
+	}
+	require.Error(t, (&Decision{Result: "alert"}).Validate())
+}
+
+// fakeOPA installs a script standing in for opa that checks its arguments
+// and prints out.
+func fakeOPA(t *testing.T, out string) string {
+	path := filepath.Join(t.TempDir(), "opa")
+	script := "#!/bin/sh\n" +
+		`[ "$1 $2 $3 $4" = "eval --format json --data" ] || exit 2` + "\n" +
+		"cat >/dev/null\n" +
+		"echo '" + out + "'\n"
+	require.NoError(t, os.WriteFile(path, []byte(script), 0o755))
+	return path
+}
+
+func TestOPAEval(t *testing.T) {
+	opa := &OPA{Path: fakeOPA(t, `{"result":[{"expressions":[{"value":{"result":"deny"}}]}]}`), Dir: t.TempDir()}
+	d, err := opa.Eval(context.Background(), "git", []byte(`{}`))
+	require.NoError(t, err)
+	require.Equal(t, "deny", d.Result)
+}
+
+func TestOPAEvalReal(t *testing.T) {
+	path, err := exec.LookPath("opa")
+	if err != nil {
+		t.Skip("opa not installed")
+	}
+	opa := &OPA{Path: path, Dir: "testdata/bundle"}
+
+	d, err := opa.Eval(context.Background(), "git", []byte(`{"action":"pull","details":{"repo":"github.com/invisirisk-demo/app"}}`))
+	require.NoError(t, err)
+	require.Equal(t, "allow", d.Result)
+
+	d, err = opa.Eval(context.Background(), "git", []byte(`{"action":"pull","details":{"repo":"github.com/TheTorProject/gettorbrowser"}}`))
+	require.NoError(t, err)
+	require.Equal(t, &Decision{Result: "alert/warn", Details: "accessing repo github.com/TheTorProject/gettorbrowser with action pull"}, d)
+}
+
+func tarball(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, body := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg}))
+		tw.Write([]byte(body))
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestOpenTarball(t *testing.T) {
+	const gitPolicy = "package git\n\ndecision = {\"result\": \"allow\"}\n"
+	path := filepath.Join(t.TempDir(), "policy.tar.gz")
+	require.NoError(t, os.WriteFile(path, tarball(t, map[string]string{"git/git.rego": gitPolicy}), 0o644))
+	dir, cleanup, err := Open(path)
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(dir, "git", "git.rego"))
+	require.NoError(t, err)
+	require.Equal(t, gitPolicy, string(data))
+	cleanup()
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestExtractUnsafePath(t *testing.T) {
+	err := Extract(bytes.NewReader(tarball(t, map[string]string{"../evil.rego": "x"})), t.TempDir())
+	require.Error(t, err)
+}
@@ -0,0 +1,38 @@
+// Package policytest runs recorded policy cases from go test, so policy
+// repositories can check their decisions in CI:
+//
+//	func TestPolicy(t *testing.T) {
+//		policytest.Run(t, &policy.OPA{Dir: "."}, "testdata/cases")
+//	}
+package policytest
+
+import (
+	"context"
+	"testing"
+
+	"inivisirisk.com/demo/demo/policy"
+)
+
+// Run evaluates every case in dir as a subtest.
+func Run(t *testing.T, ev policy.Evaluator, dir string) {
+	t.Helper()
+	cases, err := policy.LoadCases(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatalf("no cases in %s", dir)
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			res := policy.Run(context.Background(), ev, []policy.Case{c})[0]
+			if res.Err != nil {
+				t.Fatal(res.Err)
+			}
+			if res.Diff != "" {
+				t.Error(res.Diff)
+			}
+		})
+	}
+}
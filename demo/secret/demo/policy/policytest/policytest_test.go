@@ -0,0 +1,24 @@
+package policytest
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+
+	"inivisirisk.com/demo/demo/policy"
+)
+
+func TestRunWithOPA(t *testing.T) {
+	path, err := exec.LookPath("opa")
+	if err != nil {
+		t.Skip("opa not installed")
+	}
+	Run(t, &policy.OPA{Path: path, Dir: "../testdata/bundle"}, "../testdata/cases")
+}
+
+func TestRunStub(t *testing.T) {
+	allow := policy.EvalFunc(func(ctx context.Context, pkg string, input []byte) (*policy.Decision, error) {
+		return &policy.Decision{Result: "allow"}, nil
+	})
+	Run(t, allow, "testdata")
+}
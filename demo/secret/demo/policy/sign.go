@@ -0,0 +1,87 @@
+package policy
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ErrBadSignature is returned when a bundle does not match its signature.
+var ErrBadSignature = errors.New("policy: bundle signature does not verify")
+
+// GenerateKey returns a new ed25519 key pair, PEM encoded.
+func GenerateKey() (pubPEM, privPEM []byte, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), nil
+}
+
+// Sign signs bundle with a PEM encoded ed25519 private key. The signature is
+// base64 encoded, the format cosign sign-blob writes.
+func Sign(bundle, privPEM []byte) ([]byte, error) {
+	block, _ := pem.Decode(privPEM)
+	if block == nil {
+		return nil, errors.New("policy: no PEM private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("policy: parsing private key: %w", err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("policy: signing needs an ed25519 key, got %T", key)
+	}
+	sig := ed25519.Sign(priv, bundle)
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n"), nil
+}
+
+// Verify checks a base64 signature of bundle against a PEM encoded public
+// key. Besides ed25519 keys it accepts the ECDSA P-256 keys cosign generates,
+// whose signatures cover the SHA-256 digest of the bundle.
+func Verify(bundle, sig, pubPEM []byte) error {
+	block, _ := pem.Decode(pubPEM)
+	if block == nil {
+		return errors.New("policy: no PEM public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("policy: parsing public key: %w", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+	if err != nil {
+		return fmt.Errorf("policy: decoding signature: %w", err)
+	}
+
+	switch pub := key.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, bundle, raw) {
+			return ErrBadSignature
+		}
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(bundle)
+		if !ecdsa.VerifyASN1(pub, digest[:], raw) {
+			return ErrBadSignature
+		}
+	default:
+		return fmt.Errorf("policy: unsupported public key %T", key)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package policy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, err := GenerateKey()
+	require.NoError(t, err)
+	bundle := []byte("policy bundle")
+
+	sig, err := Sign(bundle, priv)
+	require.NoError(t, err)
+	require.NoError(t, Verify(bundle, sig, pub))
+
+	require.ErrorIs(t, Verify([]byte("policy bundle, allow all"), sig, pub), ErrBadSignature)
+
+	other, _, err := GenerateKey()
+	require.NoError(t, err)
+	require.ErrorIs(t, Verify(bundle, sig, other), ErrBadSignature)
+
+	require.Error(t, Verify(bundle, []byte("not base64!"), pub))
+	require.Error(t, Verify(bundle, sig, []byte("no key")))
+}
+
+func TestVerifyCosignECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	pub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	bundle := []byte("policy bundle")
+	digest := sha256.Sum256(bundle)
+	raw, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	sig := []byte(base64.StdEncoding.EncodeToString(raw))
+
+	require.NoError(t, Verify(bundle, sig, pub))
+	require.ErrorIs(t, Verify([]byte("tampered"), sig, pub), ErrBadSignature)
+}
@@ -0,0 +1,21 @@
+package git
+
+import future.keywords.in
+
+alert(repo, act) = output {
+	item := [repo, act]
+
+	output := sprintf("accessing repo %s with action %s", item)
+}
+
+read_allow {
+	glob.match("github.com/invisirisk-demo/**", [], input.details.repo)
+	input.action in ["pull"]
+}
+
+decision = {"result": "alert/crit", "details": sprintf("force push to %s", [input.details.repo])} {
+	input.action == "push"
+	input.details.force
+} else = {"result": "allow"} {
+	read_allow
+} else := {"result": "alert/warn", "details": alert(input.details.repo, input.action)}
@@ -0,0 +1,15 @@
+package go
+
+import future.keywords.in
+
+# Module versions builds may not fetch.
+denied := {"github.com/hirochachacha/go-smb2": {"v1.0.0", "v1.0.1"}}
+
+deny {
+	input.action in ["info", "mod", "zip", "lookup"]
+	input.details.version in denied[input.details.module]
+}
+
+decision = {"result": "deny", "details": sprintf("module %s@%s is denied", [input.details.module, input.details.version])} {
+	deny
+} else := {"result": "allow"}
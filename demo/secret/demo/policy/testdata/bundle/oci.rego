@@ -0,0 +1,15 @@
+package oci
+
+import future.keywords.in
+
+# Registries builds may push to.
+push_registries := {"ghcr.io"}
+
+decision = {"result": "deny", "details": sprintf("push to %s", [input.details.registry])} {
+	input.action == "push"
+	not input.details.registry in push_registries
+} else = {"result": "alert/warn", "details": sprintf("%s pulled by mutable tag %s", [input.details.repository, input.details.tag])} {
+	input.action == "pull"
+	input.details.object == "manifest"
+	input.details.tag
+} else := {"result": "allow"}
@@ -0,0 +1,7 @@
+package pypi
+
+# Source distributions run setup code at install time.
+decision = {"result": "alert/warn", "details": sprintf("installing %s from source", [input.details.filename])} {
+	input.action == "download"
+	input.details.download_type == "sdist"
+} else := {"result": "allow"}
@@ -0,0 +1,8 @@
+package smb
+
+# Builds have no business mounting file shares; each mount may carry data
+# out past the HTTPS inspection.
+decision = {"result": "alert/crit", "details": sprintf("share %s mounted as %s", [input.details.share, input.details.user])} {
+	input.action == "connect"
+	input.details.share != "IPC$"
+} else := {"result": "allow"}
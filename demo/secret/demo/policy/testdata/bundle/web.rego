@@ -0,0 +1,6 @@
+package web
+
+decision = {"result": "alert/crit", "details": "post to risky.com"} {
+	input.action == "post"
+	startswith(input.details.url, "https://risky.com/")
+} else := {"result": "allow"}
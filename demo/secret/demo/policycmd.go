@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"inivisirisk.com/demo/demo/policy"
+)
+
+var policyOpts struct {
+	bundle string
+	opa    string
+	input  string
+	pkg    string
+	cases  string
+	junit  string
+
+	url      string
+	token    string
+	out      string
+	cacheDir string
+	maxSize  int64
+
+	publicKey    string
+	signature    string
+	signatureURL string
+	key          string
+	force        bool
+}
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Work with PSE Rego policies",
+}
+
+var policyEvalCmd = &cobra.Command{
+	Use:   "eval",
+	Short: "Evaluate the decision of a policy for an input event",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		input, err := readFile(cmd, policyOpts.input)
+		if err != nil {
+			return err
+		}
+		pkg := policyOpts.pkg
+		if pkg == "" {
+			var ev struct {
+				Type string `json:"type"`
+			}
+			if err := json.Unmarshal(input, &ev); err != nil {
+				return fmt.Errorf("parsing input: %w", err)
+			}
+			if ev.Type == "" {
+				return fmt.Errorf("input has no type, use --package")
+			}
+			pkg = ev.Type
+		}
+
+		dir, cleanup, err := openBundle()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		d, err := (&policy.OPA{Path: policyOpts.opa, Dir: dir}).Eval(cmd.Context(), pkg, input)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	},
+}
+
+var policyTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Check a policy against recorded events and their expected decisions",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cases, err := policy.LoadCases(policyOpts.cases)
+		if err != nil {
+			return err
+		}
+		dir, cleanup, err := openBundle()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		results := policy.Run(cmd.Context(), &policy.OPA{Path: policyOpts.opa, Dir: dir}, cases)
+		failed := 0
+		out := cmd.OutOrStdout()
+		for _, r := range results {
+			switch {
+			case r.Err != nil:
+				fmt.Fprintf(out, "ERROR %s: %v\n", r.Case.Name, r.Err)
+			case r.Diff != "":
+				fmt.Fprintf(out, "FAIL  %s\n", r.Case.Name)
+				for _, line := range strings.Split(r.Diff, "\n") {
+					fmt.Fprintf(out, "      %s\n", line)
+				}
+			default:
+				fmt.Fprintf(out, "PASS  %s\n", r.Case.Name)
+			}
+			if !r.Passed() {
+				failed++
+			}
+		}
+
+		if policyOpts.junit != "" {
+			f, err := os.Create(policyOpts.junit)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if err := policy.WriteJUnit(f, "policy", results); err != nil {
+				return err
+			}
+		}
+		if failed > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%d of %d cases failed", failed, len(results))
+		}
+		return nil
+	},
+}
+
+var policyFetchCmd = &cobra.Command{
+	Use:   "fetch",
+	Short: "Fetch the policy from POLICY_URL as the PSE service does",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		url, token := policyOpts.url, policyOpts.token
+		if url == "" {
+			url = os.Getenv("POLICY_URL")
+		}
+		if token == "" {
+			token = os.Getenv("POLICY_AUTH_TOKEN")
+		}
+		if url == "" {
+			return fmt.Errorf("no policy URL, set POLICY_URL or use --policy-url")
+		}
+		f := &policy.Fetcher{
+			URL:      url,
+			Token:    token,
+			MaxSize:  policyOpts.maxSize,
+			CacheDir: policyOpts.cacheDir,
+		}
+		if key := publicKeyPath(); key != "" {
+			pub, err := os.ReadFile(key)
+			if err != nil {
+				return err
+			}
+			f.PublicKey = pub
+			f.SignatureURL = policyOpts.signatureURL
+			if f.SignatureURL == "" {
+				f.SignatureURL = os.Getenv("POLICY_SIGNATURE_URL")
+			}
+			// Keep the tarball as signed, next to its signature, so that
+			// verify and eval check the same bytes again.
+			tarball, sig, err := f.FetchSigned(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(policyOpts.out, tarball, 0o644); err != nil {
+				return err
+			}
+			sigFile := policyOpts.signature
+			if sigFile == "" {
+				sigFile = policyOpts.out + ".sig"
+			}
+			if err := os.WriteFile(sigFile, sig, 0o644); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "fetched and verified policy from %s, written to %s\n", url, policyOpts.out)
+			return nil
+		}
+		bundle, cached, err := f.Fetch(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(policyOpts.out, bundle, 0o644); err != nil {
+			return err
+		}
+		how := "fetched"
+		if cached {
+			how = "unchanged, using cached"
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s policy from %s, written to %s\n", how, url, policyOpts.out)
+		return nil
+	},
+}
+
+var policySignCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "Sign a policy tarball with an ed25519 key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bundle, err := os.ReadFile(policyOpts.bundle)
+		if err != nil {
+			return err
+		}
+		key, err := os.ReadFile(policyOpts.key)
+		if err != nil {
+			return err
+		}
+		sig, err := policy.Sign(bundle, key)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(signaturePath(), sig, 0o644)
+	},
+}
+
+var policyVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the signature of a policy tarball",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if publicKeyPath() == "" {
+			return fmt.Errorf("no public key, set POLICY_PUBLIC_KEY or use --public-key")
+		}
+		if _, err := verifiedBundle(); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: signature verified\n", policyOpts.bundle)
+		return nil
+	},
+}
+
+var policyKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate an ed25519 key pair for signing policies",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pubFile := strings.TrimSuffix(policyOpts.key, ".key") + ".pub"
+		if !policyOpts.force {
+			for _, name := range []string{policyOpts.key, pubFile} {
+				if _, err := os.Stat(name); err == nil {
+					return fmt.Errorf("%s exists, use --force to replace the key pair", name)
+				} else if !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			}
+		}
+		pub, priv, err := policy.GenerateKey()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(policyOpts.key, priv, 0o600); err != nil {
+			return err
+		}
+		return os.WriteFile(pubFile, pub, 0o644)
+	},
+}
+
+func init() {
+	policyCmd.PersistentFlags().StringVar(&policyOpts.bundle, "bundle", ".", "policy directory or tarball")
+	policyCmd.PersistentFlags().StringVar(&policyOpts.opa, "opa", "opa", "opa binary used to evaluate policies")
+	policyEvalCmd.Flags().StringVar(&policyOpts.input, "input", "-", "input event JSON file, - for stdin")
+	policyEvalCmd.Flags().StringVar(&policyOpts.pkg, "package", "", "policy package, taken from the type of the input if empty")
+	policyTestCmd.Flags().StringVar(&policyOpts.cases, "cases", "testdata/cases", "directory of case JSON files")
+	policyTestCmd.Flags().StringVar(&policyOpts.junit, "junit", "", "also write a JUnit XML report to this file")
+	policyFetchCmd.Flags().StringVar(&policyOpts.url, "policy-url", "", "policy tarball URL (default $POLICY_URL)")
+	policyFetchCmd.Flags().StringVar(&policyOpts.token, "policy-auth-token", "", "bearer token used to fetch the policy (default $POLICY_AUTH_TOKEN)")
+	policyFetchCmd.Flags().StringVar(&policyOpts.out, "out", "policy.tar.gz", "where to write the normalized bundle, or the tarball as signed with --public-key")
+	policyFetchCmd.Flags().StringVar(&policyOpts.cacheDir, "cache-dir", "", "directory caching the policy between runs")
+	policyFetchCmd.Flags().Int64Var(&policyOpts.maxSize, "max-size", policy.DefaultMaxSize, "largest policy tarball accepted, in bytes")
+	policyFetchCmd.Flags().StringVar(&policyOpts.signatureURL, "signature-url", "", "URL of the policy signature checked against --public-key (default $POLICY_SIGNATURE_URL)")
+	policyCmd.PersistentFlags().StringVar(&policyOpts.publicKey, "public-key", "", "PEM public key file the bundle must be signed with (default $POLICY_PUBLIC_KEY)")
+	policyCmd.PersistentFlags().StringVar(&policyOpts.signature, "signature", "", "bundle signature file (default <bundle>.sig)")
+	for _, c := range []*cobra.Command{policySignCmd, policyKeygenCmd} {
+		c.Flags().StringVar(&policyOpts.key, "key", "pse-policy.key", "ed25519 private key, the public key goes next to it as .pub")
+	}
+	policyKeygenCmd.Flags().BoolVar(&policyOpts.force, "force", false, "replace an existing key pair")
+	policyCmd.AddCommand(policyEvalCmd, policyTestCmd, policyFetchCmd, policySignCmd, policyVerifyCmd, policyKeygenCmd)
+	rootCmd.AddCommand(policyCmd)
+}
+
+// openBundle opens the policy bundle, verifying its signature first if a
+// public key is configured. A bundle that does not verify is never
+// evaluated, and the bytes evaluated are the ones that were verified.
+func openBundle() (string, func(), error) {
+	if publicKeyPath() == "" {
+		return policy.Open(policyOpts.bundle)
+	}
+	bundle, err := verifiedBundle()
+	if err != nil {
+		return "", nil, err
+	}
+	return policy.Unpack(bundle)
+}
+
+// publicKeyPath returns the key bundles must be signed with, if any.
+func publicKeyPath() string {
+	if policyOpts.publicKey != "" {
+		return policyOpts.publicKey
+	}
+	return os.Getenv("POLICY_PUBLIC_KEY")
+}
+
+// verifiedBundle reads the bundle tarball and returns it once its signature
+// verifies.
+func verifiedBundle() ([]byte, error) {
+	if fi, err := os.Stat(policyOpts.bundle); err == nil && fi.IsDir() {
+		return nil, fmt.Errorf("%s is a directory, only tarballs can be verified", policyOpts.bundle)
+	}
+	bundle, err := os.ReadFile(policyOpts.bundle)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := os.ReadFile(signaturePath())
+	if err != nil {
+		return nil, err
+	}
+	pub, err := os.ReadFile(publicKeyPath())
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.Verify(bundle, sig, pub); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+func signaturePath() string {
+	if policyOpts.signature != "" {
+		return policyOpts.signature
+	}
+	return policyOpts.bundle + ".sig"
+}
+
+func readFile(cmd *cobra.Command, name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(cmd.InOrStdin())
+	}
+	return os.ReadFile(name)
+}
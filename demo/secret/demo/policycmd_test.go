@@ -0,0 +1,69 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/policy"
+)
+
+// fakeOPA stands in for opa eval, allowing git events when the policy was
+// unpacked with the GitHub directory removed.
+const fakeOPA = `#!/bin/sh
+test -f "$5/git.rego" || { echo "no git.rego in $5" >&2; exit 1; }
+echo '{"result":[{"expressions":[{"value":{"result":"allow"}}]}]}'
+`
+
+func TestPolicyFetchVerifyEval(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	const rego = "package git\n\ndecision = {\"result\": \"allow\"}\n"
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "org-policy-1a2b3c4/git.rego", Mode: 0o644, Size: int64(len(rego)), Typeflag: tar.TypeReg}))
+	tw.Write([]byte(rego))
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	tgz := buf.Bytes()
+
+	pub, priv, err := policy.GenerateKey()
+	require.NoError(t, err)
+	sig, err := policy.Sign(tgz, priv)
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/policy.sig" {
+			w.Write(sig)
+			return
+		}
+		w.Write(tgz)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	pubFile, opa, input := filepath.Join(dir, "pse-policy.pub"), filepath.Join(dir, "opa"), filepath.Join(dir, "event.json")
+	require.NoError(t, os.WriteFile(pubFile, pub, 0o644))
+	require.NoError(t, os.WriteFile(opa, []byte(fakeOPA), 0o755))
+	require.NoError(t, os.WriteFile(input, []byte(`{"type":"git"}`), 0o644))
+	bundle := filepath.Join(dir, "policy.tar.gz")
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetArgs(nil)
+	for _, args := range [][]string{
+		{"policy", "fetch", "--policy-url", srv.URL + "/policy", "--signature-url", srv.URL + "/policy.sig", "--out", bundle},
+		{"policy", "verify"},
+		{"policy", "eval", "--opa", opa, "--input", input},
+	} {
+		rootCmd.SetArgs(append(args, "--public-key", pubFile, "--bundle", bundle))
+		require.NoError(t, rootCmd.Execute(), args[1])
+	}
+	require.Equal(t, "fetched and verified policy from "+srv.URL+"/policy, written to "+bundle+"\n"+
+		bundle+": signature verified\n"+
+		"{\n  \"result\": \"allow\"\n}\n", out.String())
+}
@@ -0,0 +1,414 @@
+// Package proxy is a transparent TLS intercepting proxy. Connections
+// redirected to it by the pse nat chain are terminated with a certificate
+// minted for the requested server name, forwarded to the real server and
+// logged as one Transaction per request. Plain HTTP redirected to the same
+// port is forwarded and logged alike.
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"time"
+
+	"inivisirisk.com/demo/demo/ca"
+	"inivisirisk.com/demo/demo/classify"
+	"inivisirisk.com/demo/demo/event"
+	"inivisirisk.com/demo/demo/policy"
+	"inivisirisk.com/demo/demo/secrets"
+)
+
+// MaxInspectSize bounds the response bodies buffered for inspectors.
+const MaxInspectSize = 128 << 20
+
+// Transaction is one intercepted HTTP exchange.
+type Transaction struct {
+	Time          time.Time         `json:"time"`
+	Client        string            `json:"client"`
+	SNI           string            `json:"sni"`
+	Method        string            `json:"method"`
+	URL           string            `json:"url"`
+	Status        int               `json:"status"`
+	RequestType   string            `json:"request_type,omitempty"`
+	RequestBytes  int64             `json:"request_bytes"`
+	ResponseType  string            `json:"response_type,omitempty"`
+	ResponseBytes int64             `json:"response_bytes"`
+	DurationMS    int64             `json:"duration_ms"`
+	Error         string            `json:"error,omitempty"`
+	Event         *event.Event      `json:"event,omitempty"`
+	Alerts        []policy.Decision `json:"alerts,omitempty"`
+}
+
+// Inspector examines the bodies of successful responses.
+type Inspector interface {
+	// Wants reports whether the response body for e should be buffered.
+	Wants(e *event.Event) bool
+	// Inspect receives the decoded body and returns any alerts. It may
+	// annotate e. It is not called for HEAD requests or empty bodies,
+	// which have nothing to inspect.
+	Inspect(e *event.Event, body []byte) []policy.Decision
+}
+
+// Proxy intercepts TLS connections.
+type Proxy struct {
+	// Transport sends requests to the real servers.
+	Transport http.RoundTripper
+	// Log receives every completed transaction. It may be called
+	// concurrently.
+	Log func(*Transaction)
+	// Classifier, if set, attaches an event to each transaction.
+	Classifier classify.Classifier
+	// Inspectors see the bodies of classified responses.
+	Inspectors []Inspector
+	// Secrets, if set, scans the bodies of web requests as they are
+	// forwarded. Findings are added to the event and raise alerts rated by
+	// their confidence.
+	Secrets *secrets.Scanner
+
+	certs *ca.Cache
+}
+
+// New returns a proxy minting certificates from authority.
+func New(authority *ca.Authority, log func(*Transaction)) *Proxy {
+	return &Proxy{
+		Transport: http.DefaultTransport,
+		Log:       log,
+		Secrets:   secrets.New(),
+		certs:     &ca.Cache{CA: authority},
+	}
+}
+
+// Serve accepts redirected connections on ln.
+func (p *Proxy) Serve(ln net.Listener) error {
+	cfg := &tls.Config{
+		GetCertificate: p.certs.GetCertificate,
+		NextProtos:     []string{"http/1.1"},
+	}
+	srv := &http.Server{Handler: p, ReadHeaderTimeout: time.Minute}
+	return srv.Serve(newSniffListener(ln, cfg))
+}
+
+// sniffListener terminates TLS on connections that start with a TLS
+// handshake record and passes the others on as plain HTTP. Connections are
+// sniffed in their own goroutines so a silent client does not hold up the
+// others.
+type sniffListener struct {
+	net.Listener
+	tls *tls.Config
+
+	conns chan net.Conn
+	// failed is closed when accepting fails with err.
+	failed chan struct{}
+	err    error
+	done   chan struct{}
+	close  sync.Once
+}
+
+func newSniffListener(ln net.Listener, cfg *tls.Config) *sniffListener {
+	l := &sniffListener{
+		Listener: ln,
+		tls:      cfg,
+		conns:    make(chan net.Conn),
+		failed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go l.accept()
+	return l
+}
+
+func (l *sniffListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.failed:
+		return nil, l.err
+	}
+}
+
+// accept hands connections to Accept until the listener fails. Temporary
+// errors, such as running out of file descriptors, are retried with a
+// backoff the way net/http does.
+func (l *sniffListener) accept() {
+	var delay time.Duration
+	for {
+		c, err := l.Listener.Accept()
+		if ne, ok := err.(net.Error); ok && ne.Temporary() {
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay *= 2; delay > time.Second {
+				delay = time.Second
+			}
+			select {
+			case <-time.After(delay):
+				continue
+			case <-l.done:
+			}
+		}
+		if err != nil {
+			l.err = err
+			close(l.failed)
+			return
+		}
+		delay = 0
+		go func() {
+			r := bufio.NewReader(c)
+			c.SetReadDeadline(time.Now().Add(time.Minute))
+			b, err := r.Peek(1)
+			c.SetReadDeadline(time.Time{})
+			if err != nil {
+				c.Close()
+				return
+			}
+			var conn net.Conn = &peekedConn{Conn: c, r: r}
+			if b[0] == 0x16 { // TLS handshake record
+				conn = tls.Server(conn, l.tls)
+			}
+			select {
+			case l.conns <- conn:
+			case <-l.done:
+				c.Close()
+			}
+		}()
+	}
+}
+
+func (l *sniffListener) Close() error {
+	l.close.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// peekedConn reads through the buffer that sniffed it.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+// ServeHTTP forwards r to the server it was addressed to.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tx := &Transaction{
+		Time:        time.Now(),
+		Client:      r.RemoteAddr,
+		Method:      r.Method,
+		RequestType: r.Header.Get("Content-Type"),
+	}
+	if r.TLS != nil {
+		tx.SNI = r.TLS.ServerName
+	}
+	host := r.Host
+	if host == "" {
+		host = tx.SNI
+	}
+	scheme := "https"
+	if r.TLS == nil {
+		scheme = "http"
+	}
+	tx.URL = scheme + "://" + host + r.URL.RequestURI()
+	// The certificate was minted for the server name, so a request for
+	// another host on the same connection must not be forwarded there.
+	if tx.SNI != "" && !sameHost(host, tx.SNI) {
+		tx.Status = http.StatusMisdirectedRequest
+		tx.Error = "host " + host + " does not match server name " + tx.SNI
+		http.Error(w, tx.Error, tx.Status)
+		if p.Log != nil {
+			p.Log(tx)
+		}
+		return
+	}
+	if p.Classifier != nil {
+		tx.Event = p.Classifier.Classify(r)
+	}
+
+	var web *event.WebDetails
+	if tx.Event != nil {
+		web, _ = tx.Event.Details.(*event.WebDetails)
+	}
+	var scan *scanBody
+	if r.Body != nil {
+		r.Body = &countingBody{ReadCloser: r.Body, n: &tx.RequestBytes}
+		if p.Secrets != nil && web != nil {
+			scan = newScanBody(r.Body, p.Secrets)
+			r.Body = scan
+		}
+	}
+	rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+	var inspect *teeBody
+	rp := &httputil.ReverseProxy{
+		Director: func(out *http.Request) {
+			out.URL.Scheme = scheme
+			out.URL.Host = host
+		},
+		Transport: p.Transport,
+		ModifyResponse: func(resp *http.Response) error {
+			if resp.StatusCode == http.StatusOK && r.Method != http.MethodHead && p.wants(tx.Event) {
+				inspect = &teeBody{ReadCloser: resp.Body}
+				resp.Body = inspect
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			tx.Error = err.Error()
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	rp.ServeHTTP(rec, r)
+
+	tx.Status = rec.status
+	tx.ResponseType = rec.Header().Get("Content-Type")
+	tx.ResponseBytes = rec.n
+	tx.DurationMS = time.Since(tx.Time).Milliseconds()
+	if inspect != nil && inspect.done {
+		p.inspect(tx, inspect.buf.Bytes(), rec.Header().Get("Content-Encoding"))
+	}
+	if scan != nil {
+		web.Secrets = scan.finish()
+		for _, f := range web.Secrets {
+			tx.Alerts = append(tx.Alerts, policy.Decision{Result: f.Confidence.Result(), Details: f.String()})
+		}
+	}
+	if p.Log != nil {
+		p.Log(tx)
+	}
+}
+
+// sameHost reports whether the Host header host names server, ignoring
+// case, a port and a trailing dot.
+func sameHost(host, server string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.EqualFold(strings.TrimSuffix(host, "."), strings.TrimSuffix(server, "."))
+}
+
+func (p *Proxy) wants(e *event.Event) bool {
+	for _, in := range p.Inspectors {
+		if in.Wants(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Proxy) inspect(tx *Transaction, body []byte, contentEncoding string) {
+	if contentEncoding != "" {
+		r, err := secrets.Decompress(bytes.NewReader(body), contentEncoding)
+		if err != nil {
+			return
+		}
+		defer r.Close()
+		if body, err = io.ReadAll(io.LimitReader(r, MaxInspectSize)); err != nil {
+			return
+		}
+	}
+	if len(body) == 0 {
+		return
+	}
+	for _, in := range p.Inspectors {
+		if in.Wants(tx.Event) {
+			tx.Alerts = append(tx.Alerts, in.Inspect(tx.Event, body)...)
+		}
+	}
+}
+
+// teeBody keeps a copy of a response body of up to MaxInspectSize bytes;
+// done is set once all of it has been read.
+type teeBody struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	done     bool
+	overflow bool
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.overflow {
+		if b.buf.Len()+n > MaxInspectSize {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.overflow {
+		b.done = true
+	}
+	return n, err
+}
+
+// scanBody passes a request body through a secrets stream as the transport
+// reads it. The transport may still be reading when the exchange is logged,
+// so finish stops the scan under the same lock.
+type scanBody struct {
+	io.ReadCloser
+	mu       sync.Mutex
+	st       *secrets.Stream
+	findings []secrets.Finding
+}
+
+func newScanBody(body io.ReadCloser, s *secrets.Scanner) *scanBody {
+	b := &scanBody{ReadCloser: body}
+	b.st = s.NewStream(0, func(f secrets.Finding) { b.findings = append(b.findings, f) })
+	return b
+}
+
+func (b *scanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	if b.st != nil {
+		b.st.Write(p[:n])
+	}
+	b.mu.Unlock()
+	return n, err
+}
+
+// finish scans what is buffered and returns the findings.
+func (b *scanBody) finish() []secrets.Finding {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.st != nil {
+		b.st.Close()
+		b.st = nil
+	}
+	return b.findings
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	*b.n += int64(n)
+	return n, err
+}
+
+type recorder struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"inivisirisk.com/demo/demo/ca"
+	"inivisirisk.com/demo/demo/classify"
+	"inivisirisk.com/demo/demo/event"
+	"inivisirisk.com/demo/demo/gosum"
+	"inivisirisk.com/demo/demo/integrity"
+	"inivisirisk.com/demo/demo/iptables"
+	"inivisirisk.com/demo/demo/proxy"
+	"inivisirisk.com/demo/demo/smb"
+)
+
+var proxyOpts struct {
+	listen  string
+	smb     string
+	caCert  string
+	caKey   string
+	log     string
+	goproxy []string
+	goSum   []string
+	npm     []string
+	maven   []string
+	pypi    []string
+}
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Run a local TLS intercepting proxy logging every transaction",
+	Long: `Run a local TLS intercepting proxy logging every transaction.
+
+The proxy's own connections must not pass through the pse chain, so run it
+outside the network namespace of the build, as the PSE service container is.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sums := gosum.NewVerifier()
+		for _, path := range proxyOpts.goSum {
+			if err := sums.LoadGoSum(path); err != nil {
+				return err
+			}
+		}
+		authority, err := ca.LoadOrCreate("PSE Proxy CA", proxyOpts.caCert, proxyOpts.caKey)
+		if err != nil {
+			return err
+		}
+
+		var out io.Writer = cmd.OutOrStdout()
+		if proxyOpts.log != "" {
+			f, err := os.OpenFile(proxyOpts.log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		var mu sync.Mutex
+		enc := json.NewEncoder(out)
+		p := proxy.New(authority, func(tx *proxy.Transaction) {
+			mu.Lock()
+			defer mu.Unlock()
+			enc.Encode(tx)
+		})
+		var private classify.Chain
+		if len(proxyOpts.goproxy) > 0 {
+			private = append(private, &classify.GoProxy{Proxies: proxyOpts.goproxy})
+		}
+		if len(proxyOpts.npm) > 0 {
+			private = append(private, &classify.NPM{Registries: proxyOpts.npm})
+		}
+		if len(proxyOpts.maven) > 0 {
+			private = append(private, &classify.Maven{Repositories: proxyOpts.maven})
+		}
+		if len(proxyOpts.pypi) > 0 {
+			private = append(private, &classify.PyPI{Indexes: proxyOpts.pypi})
+		}
+		p.Classifier = append(private, classify.Default()...)
+		p.Inspectors = []proxy.Inspector{sums, &integrity.NPM{}, &integrity.Maven{}, &integrity.PyPI{}, integrity.OCI{}}
+
+		if proxyOpts.smb != "" {
+			smbLn, err := net.Listen("tcp", proxyOpts.smb)
+			if err != nil {
+				return err
+			}
+			relay := &smb.Relay{Log: func(client string, e *event.Event) {
+				mu.Lock()
+				defer mu.Unlock()
+				enc.Encode(&proxy.Transaction{Time: e.Time, Client: client, URL: smbURL(e), Event: e})
+			}}
+			go relay.Serve(smbLn)
+			fmt.Fprintf(cmd.ErrOrStderr(), "relaying SMB on %s\n", smbLn.Addr())
+		}
+
+		ln, err := net.Listen("tcp", proxyOpts.listen)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "intercepting on %s, CA certificate in %s\n", ln.Addr(), proxyOpts.caCert)
+		return p.Serve(ln)
+	},
+}
+
+func init() {
+	proxyCmd.Flags().StringVar(&proxyOpts.listen, "listen", fmt.Sprintf(":%d", iptables.DefaultProxyPort), "address the pse chain redirects to")
+	proxyCmd.Flags().StringVar(&proxyOpts.smb, "smb-listen", fmt.Sprintf(":%d", iptables.DefaultSMBPort), "address smb-forward passes SMB connections to, empty to disable")
+	proxyCmd.Flags().StringVar(&proxyOpts.caCert, "ca-cert", "pse-ca.pem", "CA certificate, created if missing")
+	proxyCmd.Flags().StringVar(&proxyOpts.caKey, "ca-key", "pse-ca-key.pem", "CA private key, created if missing")
+	proxyCmd.Flags().StringVar(&proxyOpts.log, "log", "", "append transactions to this file instead of stdout")
+	proxyCmd.Flags().StringSliceVar(&proxyOpts.goproxy, "goproxy", nil, "base URLs of GOPROXY servers besides proxy.golang.org")
+	proxyCmd.Flags().StringSliceVar(&proxyOpts.npm, "npm-registry", nil, "base URLs of npm registries besides the public ones")
+	proxyCmd.Flags().StringSliceVar(&proxyOpts.maven, "maven-repository", nil, "base URLs of Maven repositories besides Maven Central")
+	proxyCmd.Flags().StringSliceVar(&proxyOpts.pypi, "pypi-index", nil, "base URLs of Python package indexes besides pypi.org")
+	proxyCmd.Flags().StringSliceVar(&proxyOpts.goSum, "go-sum", nil, "go.sum files to check downloaded modules against")
+	rootCmd.AddCommand(proxyCmd)
+}
+
+// smbURL names the server and share of an SMB event in the transaction log.
+func smbURL(e *event.Event) string {
+	d := e.Details.(*event.SMBDetails)
+	u := url.URL{Scheme: "smb", Host: d.Server}
+	if d.Share != "" {
+		u.Path = "/" + d.Share
+	}
+	return u.String()
+}
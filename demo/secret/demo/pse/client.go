@@ -0,0 +1,221 @@
+// Package pse is a client for the PSE control API used to open and close a
+// build session and to fetch the proxy CA.
+package pse
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is where the PSE service answers inside the build network.
+const DefaultBaseURL = "https://pse.invisirisk.com"
+
+// BuildInfo is the build metadata sent to /start.
+type BuildInfo struct {
+	Builder    string `json:"builder"`
+	BuildID    string `json:"build_id"`
+	BuildURL   string `json:"build_url"`
+	Project    string `json:"project"`
+	Workflow   string `json:"workflow"`
+	BuilderURL string `json:"builder_url"`
+	SCM        string `json:"scm"`
+	SCMCommit  string `json:"scm_commit"`
+	SCMBranch  string `json:"scm_branch"`
+	SCMOrigin  string `json:"scm_origin"`
+}
+
+// Form encodes b with the field names the service expects.
+func (b BuildInfo) Form() url.Values {
+	return url.Values{
+		"builder":     {b.Builder},
+		"build_id":    {b.BuildID},
+		"build_url":   {b.BuildURL},
+		"project":     {b.Project},
+		"workflow":    {b.Workflow},
+		"builder_url": {b.BuilderURL},
+		"scm":         {b.SCM},
+		"scm_commit":  {b.SCMCommit},
+		"scm_branch":  {b.SCMBranch},
+		"scm_origin":  {b.SCMOrigin},
+	}
+}
+
+// ParseBuildInfo decodes a /start form.
+func ParseBuildInfo(form url.Values) BuildInfo {
+	return BuildInfo{
+		Builder:    form.Get("builder"),
+		BuildID:    form.Get("build_id"),
+		BuildURL:   form.Get("build_url"),
+		Project:    form.Get("project"),
+		Workflow:   form.Get("workflow"),
+		BuilderURL: form.Get("builder_url"),
+		SCM:        form.Get("scm"),
+		SCMCommit:  form.Get("scm_commit"),
+		SCMBranch:  form.Get("scm_branch"),
+		SCMOrigin:  form.Get("scm_origin"),
+	}
+}
+
+// BuildResult is sent to /end once the build finished. BuildURL identifies
+// the session opened by /start.
+type BuildResult struct {
+	BuildURL string `json:"build_url"`
+	Status   string `json:"status"`
+}
+
+// Form encodes r with the field names the service expects.
+func (r BuildResult) Form() url.Values {
+	return url.Values{
+		"build_url": {r.BuildURL},
+		"status":    {r.Status},
+	}
+}
+
+// ParseBuildResult decodes an /end form.
+func ParseBuildResult(form url.Values) BuildResult {
+	return BuildResult{BuildURL: form.Get("build_url"), Status: form.Get("status")}
+}
+
+// StatusError is returned when the service answers with a non-200 status.
+type StatusError struct {
+	Endpoint   string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("pse %s: received status %d", e.Endpoint, e.StatusCode)
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// Temporary reports whether the request may succeed if retried.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Client talks to the PSE service.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Retries is the number of additional attempts made after a transient
+	// failure, waiting Backoff, then twice that, and so on.
+	Retries int
+	Backoff time.Duration
+}
+
+// NewClient returns a client for the service at baseURL. The service
+// certificate is issued by the proxy CA the build does not trust yet, so
+// certificate verification is disabled as in the action.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+		Retries: 3,
+		Backoff: time.Second,
+	}
+}
+
+// Start opens a build session.
+func (c *Client) Start(ctx context.Context, info BuildInfo) error {
+	_, err := c.do(ctx, http.MethodPost, "/start", info.Form())
+	return err
+}
+
+// End closes the build session and reports the build status.
+func (c *Client) End(ctx context.Context, res BuildResult) error {
+	_, err := c.do(ctx, http.MethodPost, "/end", res.Form())
+	return err
+}
+
+// FetchCA returns the PEM encoded CA certificate of the proxy.
+func (c *Client) FetchCA(ctx context.Context) ([]byte, error) {
+	return c.do(ctx, http.MethodGet, "/ca", nil)
+}
+
+func (c *Client) do(ctx context.Context, method, endpoint string, form url.Values) ([]byte, error) {
+	backoff := c.Backoff
+	for attempt := 0; ; attempt++ {
+		body, err := c.once(ctx, method, endpoint, form)
+		if err == nil || attempt >= c.Retries || !temporary(method, err) {
+			return body, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) once(ctx context.Context, method, endpoint string, form url.Values) ([]byte, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "pse-action")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("pse %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("pse %s: %w", endpoint, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Endpoint: endpoint, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	return data, nil
+}
+
+// temporary reports whether a request that failed with err may be sent
+// again. A POST that failed after it was sent may have been processed, so
+// it is only sent again if the service asked for that or was never reached.
+func temporary(method string, err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Temporary()
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if method != http.MethodGet {
+		var oe *net.OpError
+		return errors.As(err, &oe) && oe.Op == "dial"
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
@@ -0,0 +1,145 @@
+package pse
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testClient(t *testing.T, h http.HandlerFunc) *Client {
+	srv := httptest.NewTLSServer(h)
+	t.Cleanup(srv.Close)
+	c := NewClient(srv.URL)
+	c.Backoff = 0
+	return c
+}
+
+func TestStart(t *testing.T) {
+	var path string
+	var got http.Header
+	var form map[string][]string
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		path, got, form = r.URL.Path, r.Header, r.PostForm
+	})
+	err := c.Start(context.Background(), BuildInfo{
+		Builder:   "github",
+		BuildID:   "42",
+		BuildURL:  "https://github.com/o/r/actions/runs/42/attempts/1",
+		Project:   "o/r",
+		SCM:       "git",
+		SCMCommit: "abc",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "/start", path)
+	require.Equal(t, "application/x-www-form-urlencoded", got.Get("Content-Type"))
+	require.Equal(t, "github", form["builder"][0])
+	require.Equal(t, "https://github.com/o/r/actions/runs/42/attempts/1", form["build_url"][0])
+	require.Equal(t, "abc", form["scm_commit"][0])
+	require.Len(t, form, 10)
+}
+
+func TestEnd(t *testing.T) {
+	var path string
+	var res BuildResult
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		path, res = r.URL.Path, ParseBuildResult(r.PostForm)
+	})
+	require.NoError(t, c.End(context.Background(), BuildResult{BuildURL: "u", Status: "success"}))
+	require.Equal(t, "/end", path)
+	require.Equal(t, BuildResult{BuildURL: "u", Status: "success"}, res)
+}
+
+func TestFetchCA(t *testing.T) {
+	var method string
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		w.Write([]byte("-----BEGIN CERTIFICATE-----"))
+	})
+	ca, err := c.FetchCA(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, http.MethodGet, method)
+	require.Equal(t, "-----BEGIN CERTIFICATE-----", string(ca))
+}
+
+func TestRetryTransient(t *testing.T) {
+	calls := 0
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	})
+	require.NoError(t, c.End(context.Background(), BuildResult{}))
+	require.Equal(t, 3, calls)
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	calls := 0
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "bad build_url", http.StatusBadRequest)
+	})
+	err := c.End(context.Background(), BuildResult{})
+	var se *StatusError
+	require.True(t, errors.As(err, &se))
+	require.Equal(t, http.StatusBadRequest, se.StatusCode)
+	require.Equal(t, "bad build_url", se.Body)
+	require.Equal(t, 1, calls)
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	calls := 0
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	_, err := c.FetchCA(context.Background())
+	require.Error(t, err)
+	require.Equal(t, c.Retries+1, calls)
+}
+
+func TestNoRetryAfterPostSent(t *testing.T) {
+	calls := 0
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		// The session may have been opened, but the answer is lost.
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	})
+	require.Error(t, c.Start(context.Background(), BuildInfo{}))
+	require.Equal(t, 1, calls)
+
+	_, err := c.FetchCA(context.Background())
+	require.Error(t, err)
+	require.Equal(t, 1+c.Retries+1, calls)
+}
+
+func TestRetryPostNotSent(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	dials := 0
+	c := NewClient("http://" + addr)
+	c.Backoff = 0
+	c.HTTPClient.Transport = &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials++
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}}
+	require.Error(t, c.End(context.Background(), BuildResult{}))
+	require.Equal(t, c.Retries+1, dials)
+}
+
+func TestFormRoundTrip(t *testing.T) {
+	info := BuildInfo{Builder: "jenkins", BuildID: "1", SCMOrigin: "https://github.com/o/r"}
+	require.Equal(t, info, ParseBuildInfo(info.Form()))
+	res := BuildResult{BuildURL: "u", Status: "failure"}
+	require.Equal(t, res, ParseBuildResult(res.Form()))
+}
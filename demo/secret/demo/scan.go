@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"inivisirisk.com/demo/demo/secrets"
+)
+
+var scanOpts struct {
+	json            bool
+	minConfidence   string
+	contentType     string
+	contentEncoding string
+}
+
+var scanCmd = &cobra.Command{
+	Use:   "scan [file...]",
+	Short: "Scan files, or stdin, for secrets",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			args = []string{"-"}
+		}
+		scanner := secrets.New()
+		if err := scanner.MinConfidence.UnmarshalText([]byte(scanOpts.minConfidence)); err != nil {
+			return err
+		}
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		total := 0
+		for _, name := range args {
+			findings, err := scanInput(cmd, scanner, name)
+			if err != nil {
+				return err
+			}
+			for _, f := range findings {
+				total++
+				if scanOpts.json {
+					enc.Encode(struct {
+						File string `json:"file"`
+						secrets.Finding
+					}{name, f})
+				} else {
+					where := name
+					if f.Path != "" {
+						where += " (" + f.Path + ")"
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "%s:%d: %s [%s, %s]\n", where, f.Offset, f, f.Confidence, f.Confidence.Result())
+				}
+			}
+		}
+		if total > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%d secrets found", total)
+		}
+		return nil
+	},
+}
+
+func init() {
+	scanCmd.Flags().BoolVar(&scanOpts.json, "json", false, "print findings as JSON lines")
+	scanCmd.Flags().StringVar(&scanOpts.minConfidence, "min-confidence", "low", "only report findings rated at least low, medium or high")
+	scanCmd.Flags().StringVar(&scanOpts.contentType, "content-type", "", "Content-Type of the input, e.g. multipart/form-data; boundary=...")
+	scanCmd.Flags().StringVar(&scanOpts.contentEncoding, "content-encoding", "", "Content-Encoding of the input, e.g. gzip")
+	rootCmd.AddCommand(scanCmd)
+}
+
+func scanInput(cmd *cobra.Command, scanner *secrets.Scanner, name string) ([]secrets.Finding, error) {
+	if name == "-" {
+		return scanner.ScanBody(cmd.InOrStdin(), scanOpts.contentType, scanOpts.contentEncoding)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return scanner.ScanBody(f, scanOpts.contentType, scanOpts.contentEncoding)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/spf13/cobra"
+	"inivisirisk.com/demo/demo/event"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON schema of PSE events, the policy input",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(event.Schema())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
@@ -0,0 +1,148 @@
+package secrets
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math"
+	"strings"
+)
+
+// Confidence is how likely a finding is a live secret rather than a fixture.
+type Confidence int
+
+const (
+	// Low is a pattern match that looks like a placeholder, fails its
+	// checksum or has too little entropy.
+	Low Confidence = iota
+	// Medium is a plausible secret that cannot be validated offline.
+	Medium
+	// High is a secret with a valid checksum or an unambiguous structure
+	// such as a private key header.
+	High
+)
+
+var confidenceNames = []string{"low", "medium", "high"}
+
+func (c Confidence) String() string {
+	if c < Low || c > High {
+		return fmt.Sprintf("Confidence(%d)", int(c))
+	}
+	return confidenceNames[c]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c Confidence) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *Confidence) UnmarshalText(text []byte) error {
+	for i, name := range confidenceNames {
+		if strings.EqualFold(name, string(text)) {
+			*c = Confidence(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown confidence %q", text)
+}
+
+// Result is the policy decision result a finding of this confidence raises.
+func (c Confidence) Result() string {
+	switch c {
+	case High:
+		return "alert/crit"
+	case Medium:
+		return "alert/error"
+	default:
+		return "alert/warn"
+	}
+}
+
+// placeholders are substrings of values used in docs and test fixtures.
+var placeholders = []string{
+	"example", "xxxx", "dummy", "placeholder", "changeme", "redacted",
+	"sample", "your_", "yourtoken", "fake", "test",
+}
+
+// confidence rates a value matched by rule. A value whose checksum
+// validates is not a placeholder, whatever words its random part spells.
+func confidence(rule Rule, value string) Confidence {
+	if rule.Validate != nil {
+		if !rule.Validate(value) {
+			return Low
+		}
+	} else if isPlaceholder(value) {
+		return Low
+	}
+	if rule.MinEntropy > 0 && entropy(value) < rule.MinEntropy {
+		return Low
+	}
+	if rule.Validate != nil || rule.Structural {
+		return High
+	}
+	return Medium
+}
+
+func isPlaceholder(value string) bool {
+	lower := strings.ToLower(value)
+	for _, p := range placeholders {
+		if strings.Contains(lower, p) {
+			return true
+		}
+	}
+	// Long runs of one character, as in ghp_000000...
+	run := 1
+	for i := 1; i < len(value); i++ {
+		if value[i] == value[i-1] {
+			run++
+			if run >= 6 {
+				return true
+			}
+		} else {
+			run = 1
+		}
+	}
+	return false
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := map[rune]int{}
+	for _, r := range s {
+		counts[r]++
+	}
+	n := float64(len([]rune(s)))
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// githubChecksum returns the base62 CRC32 checksum GitHub appends to the
+// 30 random characters of a token.
+func githubChecksum(random string) string {
+	n := crc32.ChecksumIEEE([]byte(random))
+	var buf [6]byte
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = base62[n%62]
+		n /= 62
+	}
+	return string(buf[:])
+}
+
+// validGitHubToken checks the checksum of a ghp_, gho_, ghu_, ghs_ or ghr_
+// token: the last 6 of the 36 characters after the prefix.
+func validGitHubToken(token string) bool {
+	body := token[strings.IndexByte(token, '_')+1:]
+	if len(body) != 36 {
+		return false
+	}
+	return githubChecksum(body[:30]) == body[30:]
+}
@@ -0,0 +1,356 @@
+package secrets
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"inivisirisk.com/demo/demo/brotli"
+)
+
+const (
+	// MaxDecodeSize is the largest body, or decoded layer, that is
+	// unwrapped. Larger bodies are scanned as they are.
+	MaxDecodeSize = 16 << 20
+	// MaxDecodeDepth bounds how many encodings are unwrapped.
+	MaxDecodeDepth = 8
+)
+
+// ErrUnsupportedEncoding is returned by Decompress for content encodings it
+// cannot undo.
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+var (
+	base64Blob = regexp.MustCompile(`[A-Za-z0-9+/_-]{20,}={0,2}`)
+	hexBlob    = regexp.MustCompile(`\b(?:[0-9a-fA-F]{2}){16,}\b`)
+)
+
+// ScanBody returns the secrets in an HTTP body, unwrapping its content
+// encoding, multipart parts, form values, JSON strings and base64, hex,
+// percent encoded, gzip or zlib blobs. A body that fails to decode as its
+// content encoding claims is scanned as sent. Each finding's Path records how the
+// secret was hidden and its Offset is relative to that innermost layer.
+func (s *Scanner) ScanBody(r io.Reader, contentType, contentEncoding string) ([]Finding, error) {
+	d := &decoder{s: s, seen: map[string]bool{}}
+	if contentEncoding == "" {
+		err := d.typed(r, contentType, nil, 0)
+		return d.findings, err
+	}
+
+	// Keep what was sent, so that a body that is not encoded the way it
+	// claims is still scanned from its first byte.
+	raw, err := io.ReadAll(io.LimitReader(r, MaxDecodeSize+1))
+	if err != nil {
+		return nil, err
+	}
+	dr, err := Decompress(io.MultiReader(bytes.NewReader(raw), r), contentEncoding)
+	if err != nil {
+		// Decompress only reads the header, which is within raw.
+		err := d.stream(io.MultiReader(bytes.NewReader(raw), r), nil)
+		return d.findings, err
+	}
+	err = d.typed(dr, contentType, contentEncodingPath(contentEncoding), 0)
+	dr.Close()
+	if err != nil && len(raw) <= MaxDecodeSize {
+		err = d.stream(bytes.NewReader(raw), nil)
+	}
+	return d.findings, err
+}
+
+// Decompress undoes a Content-Encoding, which may list several encodings in
+// the order they were applied.
+func Decompress(r io.Reader, contentEncoding string) (io.ReadCloser, error) {
+	encs := strings.Split(contentEncoding, ",")
+	l := &layers{Reader: r}
+	for i := len(encs) - 1; i >= 0; i-- {
+		var (
+			rc  io.ReadCloser
+			err error
+		)
+		switch enc := strings.ToLower(strings.TrimSpace(encs[i])); enc {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			rc, err = gzip.NewReader(l.Reader)
+		case "deflate":
+			// deflate is zlib framed, but some servers send raw deflate.
+			rc, err = zlibOrFlate(l.Reader)
+		case "br":
+			rc = brotli.NewReader(l.Reader)
+		default:
+			err = fmt.Errorf("%w: %s", ErrUnsupportedEncoding, enc)
+		}
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.Reader = rc
+		l.closers = append(l.closers, rc)
+	}
+	return l, nil
+}
+
+// layers reads the innermost of several decompressors and closes them all,
+// which stops the goroutine of a brotli reader.
+type layers struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (l *layers) Close() error {
+	var err error
+	for i := len(l.closers) - 1; i >= 0; i-- {
+		if cerr := l.closers[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func zlibOrFlate(r io.Reader) (io.ReadCloser, error) {
+	var head [2]byte
+	n, _ := io.ReadFull(r, head[:])
+	r = io.MultiReader(bytes.NewReader(head[:n]), r)
+	if n == 2 && isZlib(head[:]) {
+		return zlib.NewReader(r)
+	}
+	return flate.NewReader(r), nil
+}
+
+func contentEncodingPath(contentEncoding string) []string {
+	var path []string
+	for _, enc := range strings.Split(contentEncoding, ",") {
+		if enc = strings.ToLower(strings.TrimSpace(enc)); enc != "" && enc != "identity" {
+			path = append([]string{enc}, path...)
+		}
+	}
+	return path
+}
+
+type decoder struct {
+	s        *Scanner
+	findings []Finding
+	// seen holds type and value of every finding, so that a secret visible
+	// at several layers is reported once, at the outermost.
+	seen map[string]bool
+}
+
+func (d *decoder) add(findings []Finding, path []string) {
+	for _, f := range findings {
+		key := f.Type + "\x00" + f.Value
+		if d.seen[key] {
+			continue
+		}
+		d.seen[key] = true
+		f.Path = strings.Join(path, " > ")
+		d.findings = append(d.findings, f)
+	}
+}
+
+// stream scans r without decoding it.
+func (d *decoder) stream(r io.Reader, path []string) error {
+	findings, err := d.s.ScanReader(r)
+	d.add(findings, path)
+	return err
+}
+
+// typed scans r according to its media type.
+func (d *decoder) typed(r io.Reader, contentType string, path []string, depth int) error {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" && depth < MaxDecodeDepth {
+		return d.multipart(r, params["boundary"], path, depth)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, MaxDecodeSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxDecodeSize {
+		return d.stream(io.MultiReader(bytes.NewReader(data), r), path)
+	}
+	d.data(data, mediaType, path, depth)
+	return nil
+}
+
+func (d *decoder) multipart(r io.Reader, boundary string, path []string, depth int) error {
+	mr := multipart.NewReader(r, boundary)
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := part.FileName()
+		if name == "" {
+			name = part.FormName()
+		}
+		partPath := with(path, "multipart:"+name)
+		var pr io.Reader = part
+		if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "base64") {
+			pr = base64.NewDecoder(base64.StdEncoding, pr)
+			partPath = with(partPath, "base64")
+		}
+		if err := d.typed(pr, part.Header.Get("Content-Type"), partPath, depth+1); err != nil {
+			return err
+		}
+	}
+}
+
+// data scans data and every encoded layer found inside it.
+func (d *decoder) data(data []byte, mediaType string, path []string, depth int) {
+	d.add(d.s.Scan(data), path)
+	if depth >= MaxDecodeDepth || len(data) == 0 {
+		return
+	}
+
+	if isGzip(data) {
+		if zr, err := gzip.NewReader(bytes.NewReader(data)); err == nil {
+			d.inflated(zr, path, "gzip", depth)
+		}
+		return
+	}
+	if isZlib(data) {
+		if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+			d.inflated(zr, path, "deflate", depth)
+		}
+		return
+	}
+
+	if mediaType == "application/x-www-form-urlencoded" {
+		if values, err := url.ParseQuery(string(data)); err == nil {
+			for _, k := range sortedKeys(values) {
+				for _, v := range values[k] {
+					d.data([]byte(v), "", with(path, "form:"+k), depth+1)
+				}
+			}
+			return
+		}
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if strings.HasSuffix(mediaType, "json") || (len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')) {
+		var v interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if dec.Decode(&v) == nil {
+			walkJSON(v, "$", func(p, s string) {
+				d.data([]byte(s), "", with(path, "json:"+p), depth+1)
+			})
+			return
+		}
+	}
+
+	if bytes.IndexByte(data, '%') >= 0 {
+		if u, err := url.QueryUnescape(string(data)); err == nil && u != string(data) {
+			d.data([]byte(u), "", with(path, "url"), depth+1)
+		}
+	}
+	for _, blob := range base64Blob.FindAll(data, -1) {
+		if dec, ok := decodeBase64(blob); ok && interesting(dec) {
+			d.data(dec, "", with(path, "base64"), depth+1)
+		}
+	}
+	for _, blob := range hexBlob.FindAll(data, -1) {
+		if dec, err := hex.DecodeString(string(blob)); err == nil && interesting(dec) {
+			d.data(dec, "", with(path, "hex"), depth+1)
+		}
+	}
+}
+
+// inflated scans what r decompresses to, up to MaxDecodeSize bytes.
+func (d *decoder) inflated(r io.ReadCloser, path []string, name string, depth int) {
+	defer r.Close()
+	data, _ := io.ReadAll(io.LimitReader(r, MaxDecodeSize))
+	d.data(data, "", with(path, name), depth+1)
+}
+
+func decodeBase64(blob []byte) ([]byte, bool) {
+	s := string(blob)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if dec, err := enc.DecodeString(s); err == nil {
+			return dec, true
+		}
+	}
+	return nil, false
+}
+
+// interesting reports whether decoded bytes are worth scanning: mostly
+// printable text or compressed data.
+func interesting(data []byte) bool {
+	if isGzip(data) || isZlib(data) {
+		return true
+	}
+	if !utf8.Valid(data) {
+		return false
+	}
+	printable, total := 0, 0
+	for _, r := range string(data) {
+		total++
+		if unicode.IsPrint(r) || unicode.IsSpace(r) {
+			printable++
+		}
+	}
+	return total > 0 && printable*10 >= total*9
+}
+
+func isGzip(data []byte) bool {
+	return len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+func isZlib(data []byte) bool {
+	return len(data) >= 2 && data[0]&0x0f == 8 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0
+}
+
+func walkJSON(v interface{}, path string, fn func(path, s string)) {
+	switch v := v.(type) {
+	case string:
+		fn(path, v)
+	case []interface{}:
+		for i, e := range v {
+			walkJSON(e, path+"["+strconv.Itoa(i)+"]", fn)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkJSON(v[k], path+"."+k, fn)
+		}
+	}
+}
+
+func sortedKeys(values url.Values) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// with returns path extended by elem without sharing path's array.
+func with(path []string, elem string) []string {
+	out := make([]string, len(path)+1)
+	copy(out, path)
+	out[len(path)] = elem
+	return out
+}
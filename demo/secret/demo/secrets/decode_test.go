@@ -0,0 +1,120 @@
+package secrets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"mime/multipart"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// bodyToken passes the checksum check, so ScanBody reports it whatever
+// decoding found it.
+var bodyToken = githubToken("ghp_", "R7mPq2vLx9KdT4nWc8ZbHy3JfGs6Ae")
+
+// gzipped compresses s after a compressible preamble, so that s does not
+// end up verbatim in a stored block.
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(strings.Repeat("build log line\n", 50) + s))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func scanBody(t *testing.T, body []byte, contentType, contentEncoding string) []Finding {
+	findings, err := New().ScanBody(bytes.NewReader(body), contentType, contentEncoding)
+	require.NoError(t, err)
+	return findings
+}
+
+func requireOne(t *testing.T, findings []Finding, path string) {
+	require.Len(t, findings, 1)
+	require.Equal(t, bodyToken, findings[0].Value)
+	require.Equal(t, path, findings[0].Path)
+}
+
+func TestScanBodyPlain(t *testing.T) {
+	requireOne(t, scanBody(t, []byte(`{"GH": "`+bodyToken+`"}`), "application/json", ""), "")
+}
+
+func TestScanBodyContentEncoding(t *testing.T) {
+	body := gzipped(t, "token="+bodyToken)
+	requireOne(t, scanBody(t, body, "text/plain", "gzip"), "gzip")
+}
+
+func TestScanBodyJSONEscapes(t *testing.T) {
+	escaped := `\u0067` + bodyToken[1:]
+	requireOne(t, scanBody(t, []byte(`{"a": {"b": ["`+escaped+`"]}}`), "application/json", ""), "json:$.a.b[0]")
+}
+
+func TestScanBodyNestedJSON(t *testing.T) {
+	inner := base64.StdEncoding.EncodeToString([]byte(`{"token": "` + bodyToken + `"}`))
+	requireOne(t, scanBody(t, []byte(`{"payload": "`+inner+`"}`), "application/json", ""), "json:$.payload > base64")
+}
+
+func TestScanBodyForm(t *testing.T) {
+	form := url.Values{
+		"build_url": {"https://example.com"},
+		"blob":      {base64.URLEncoding.EncodeToString(gzipped(t, bodyToken))},
+	}
+	requireOne(t, scanBody(t, []byte(form.Encode()), "application/x-www-form-urlencoded", ""), "form:blob > base64 > gzip")
+}
+
+func TestScanBodyMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	require.NoError(t, mw.WriteField("name", "demo"))
+	fw, err := mw.CreateFormFile("upload", "file.txt")
+	require.NoError(t, err)
+	fw.Write(gzipped(t, base64.StdEncoding.EncodeToString([]byte("GH="+bodyToken))))
+	require.NoError(t, mw.Close())
+
+	requireOne(t, scanBody(t, body.Bytes(), mw.FormDataContentType(), ""), "multipart:file.txt > gzip > base64")
+}
+
+func TestScanBodyHexAndURL(t *testing.T) {
+	h := hex.EncodeToString([]byte(bodyToken))
+	requireOne(t, scanBody(t, []byte("data="+h), "text/plain", ""), "hex")
+	requireOne(t, scanBody(t, []byte(url.QueryEscape("tok: "+bodyToken+"&")), "text/plain", ""), "")
+	encoded := strings.ReplaceAll(url.PathEscape(bodyToken), "_", "%5F")
+	requireOne(t, scanBody(t, []byte(encoded), "text/plain", ""), "url")
+}
+
+// brotliStored frames data as a brotli stream of one uncompressed
+// meta-block.
+func brotliStored(data []byte) []byte {
+	// WBITS 16, ISLAST 0, MNIBBLES 4, MLEN-1 and ISUNCOMPRESSED.
+	n := len(data) - 1
+	out := []byte{byte(n) << 4, byte(n >> 4), byte(n>>12)&0xf | 1<<4}
+	out = append(out, data...)
+	// ISLAST, ISLASTEMPTY.
+	return append(out, 3)
+}
+
+func TestScanBodyBrotli(t *testing.T) {
+	body := brotliStored([]byte("token=" + bodyToken))
+	requireOne(t, scanBody(t, body, "text/plain", "br"), "br")
+}
+
+func TestScanBodyMislabelledEncoding(t *testing.T) {
+	// The gzip and zlib readers buffer what they read before failing, and
+	// brotli fails only once decoding has started.
+	for _, enc := range []string{"gzip", "deflate", "br", "compress"} {
+		requireOne(t, scanBody(t, []byte(bodyToken+"\n"+strings.Repeat("x", 8<<10)), "", enc), "")
+	}
+	_, err := Decompress(bytes.NewReader(nil), "compress")
+	require.ErrorIs(t, err, ErrUnsupportedEncoding)
+}
+
+func TestScanBodyDedup(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString([]byte(bodyToken))
+	findings := scanBody(t, []byte(bodyToken+" "+b64), "", "")
+	requireOne(t, findings, "")
+}
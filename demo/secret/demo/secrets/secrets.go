@@ -0,0 +1,233 @@
+// Package secrets finds credentials in outgoing request bodies. Finding
+// types use the labels shown in PSE reports, e.g. GitHub-App-Token.
+package secrets
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Finding is a secret found in scanned data.
+type Finding struct {
+	Type       string     `json:"type"`
+	Value      string     `json:"value"`
+	Offset     int        `json:"offset"`
+	Confidence Confidence `json:"confidence"`
+	// Path lists the encodings the secret was found under, outermost
+	// first, e.g. "multipart:file.txt > gzip > base64".
+	Path string `json:"path,omitempty"`
+}
+
+// String formats f the way reports show it.
+func (f Finding) String() string {
+	return f.Type + ": secret value " + f.Value
+}
+
+// Rule matches one kind of secret. If Group is non-zero only that submatch
+// is reported as the value.
+type Rule struct {
+	Type string
+	// Keywords are literals every match starts with. If set, Re is only
+	// tried where one of them occurs, which is much faster than running it
+	// over all the data.
+	Keywords []string
+	// FoldCase makes Keywords match regardless of ASCII case, for rules
+	// whose Re is case-insensitive.
+	FoldCase bool
+	Re       *regexp.Regexp
+	Group    int
+	// Validate, if set, checks a checksum embedded in the value.
+	Validate func(value string) bool
+	// MinEntropy is the Shannon entropy in bits per character below which
+	// a match is considered a fixture.
+	MinEntropy float64
+	// Structural marks matches that are secrets by their shape alone.
+	Structural bool
+}
+
+// DefaultRules are the secrets PSE reports.
+var DefaultRules = []Rule{
+	{Type: "GitHub-Personal-Access-Token", Keywords: []string{"ghp_"}, Re: regexp.MustCompile(`\bghp_[A-Za-z0-9]{36}\b`), Validate: validGitHubToken, MinEntropy: 3.5},
+	{Type: "GitHub-OAuth-Token", Keywords: []string{"gho_"}, Re: regexp.MustCompile(`\bgho_[A-Za-z0-9]{36}\b`), Validate: validGitHubToken, MinEntropy: 3.5},
+	{Type: "GitHub-User-Token", Keywords: []string{"ghu_"}, Re: regexp.MustCompile(`\bghu_[A-Za-z0-9]{36}\b`), Validate: validGitHubToken, MinEntropy: 3.5},
+	{Type: "GitHub-App-Token", Keywords: []string{"ghs_"}, Re: regexp.MustCompile(`\bghs_[A-Za-z0-9]{36}\b`), Validate: validGitHubToken, MinEntropy: 3.5},
+	{Type: "GitHub-Refresh-Token", Keywords: []string{"ghr_"}, Re: regexp.MustCompile(`\bghr_[A-Za-z0-9]{36}\b`), Validate: validGitHubToken, MinEntropy: 3.5},
+	{Type: "GitHub-Fine-Grained-Token", Keywords: []string{"github_pat_"}, Re: regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9]{22}_[A-Za-z0-9]{59}\b`), MinEntropy: 4},
+	{Type: "AWS-Access-Key", Keywords: []string{"AKIA", "ASIA", "AGPA", "AIDA", "AROA", "ANPA", "ANVA", "AIPA"}, Re: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`), MinEntropy: 3},
+	{Type: "AWS-Secret-Key", Keywords: []string{"aws"}, FoldCase: true, Re: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s{0,16}[:=]\s{0,16}["']?([A-Za-z0-9/+]{40})\b`), Group: 1, MinEntropy: 4},
+	{Type: "NPM-Token", Keywords: []string{"npm_"}, Re: regexp.MustCompile(`\bnpm_[A-Za-z0-9]{36}\b`), MinEntropy: 3.5},
+	{Type: "Slack-Token", Keywords: []string{"xox"}, Re: regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,250}`), MinEntropy: 3},
+	{Type: "Slack-Webhook", Keywords: []string{"https://hooks.slack.com/"}, Re: regexp.MustCompile(`https://hooks\.slack\.com/services/T[A-Z0-9]{1,32}/B[A-Z0-9]{1,32}/[A-Za-z0-9]{1,64}`), Structural: true},
+	{Type: "Private-Key", Keywords: []string{"-----BEGIN "}, Re: regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY(?: BLOCK)?-----`), Structural: true},
+	{Type: "JWT", Keywords: []string{"eyJ"}, Re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,1000}\.eyJ[A-Za-z0-9_-]{5,1000}\.[A-Za-z0-9_-]{10,1000}`), MinEntropy: 4},
+}
+
+// Scanner applies a set of rules.
+type Scanner struct {
+	// Rules must not match more than MaxMatchLen bytes, or matches
+	// straddling a chunk boundary of a stream may be missed. They must not
+	// change once the scanner was used.
+	Rules []Rule
+	// MinConfidence drops findings rated below it.
+	MinConfidence Confidence
+
+	once     sync.Once
+	anchored []*regexp.Regexp
+	// wordStart records which rules begin with \b, a check done by hand
+	// since anchored patterns do not see the preceding byte.
+	wordStart []bool
+}
+
+// New returns a scanner using DefaultRules.
+func New() *Scanner {
+	return &Scanner{Rules: DefaultRules}
+}
+
+// Scan returns the secrets in data ordered by offset.
+func (s *Scanner) Scan(data []byte) []Finding {
+	return s.scan(data, 0, 0, len(data))
+}
+
+// compile prepares, for rules with keywords, a pattern anchored at the
+// keyword.
+func (s *Scanner) compile() {
+	s.anchored = make([]*regexp.Regexp, len(s.Rules))
+	s.wordStart = make([]bool, len(s.Rules))
+	for i, rule := range s.Rules {
+		if len(rule.Keywords) == 0 {
+			continue
+		}
+		expr := rule.Re.String()
+		if strings.HasPrefix(expr, `\b`) {
+			expr = strings.TrimPrefix(expr, `\b`)
+			s.wordStart[i] = true
+		}
+		s.anchored[i] = regexp.MustCompile(`^(?:` + expr + `)`)
+	}
+}
+
+// scan returns the findings in data whose match starts in [from, to). base
+// is the stream offset of data[0].
+func (s *Scanner) scan(data []byte, base, from, to int) []Finding {
+	s.once.Do(s.compile)
+	var findings []Finding
+	add := func(rule Rule, start, end int) {
+		value := string(data[start:end])
+		c := confidence(rule, value)
+		if c < s.MinConfidence {
+			return
+		}
+		findings = append(findings, Finding{
+			Type:       rule.Type,
+			Value:      value,
+			Offset:     base + start,
+			Confidence: c,
+		})
+	}
+
+	for i, rule := range s.Rules {
+		if s.anchored[i] == nil {
+			for _, m := range rule.Re.FindAllSubmatchIndex(data, -1) {
+				if m[0] >= from && m[0] < to {
+					add(rule, m[2*rule.Group], m[2*rule.Group+1])
+				}
+			}
+			continue
+		}
+
+		next := 0
+		for _, p := range keywordOffsets(data, rule.Keywords, rule.FoldCase, from, to) {
+			if p < next || (s.wordStart[i] && p > 0 && isWord(data[p-1])) {
+				continue
+			}
+			end := p + MaxMatchLen
+			if end > len(data) {
+				end = len(data)
+			}
+			m := s.anchored[i].FindSubmatchIndex(data[p:end])
+			if m == nil {
+				continue
+			}
+			next = p + m[1]
+			add(rule, p+m[2*rule.Group], p+m[2*rule.Group+1])
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Offset < findings[j].Offset
+	})
+	return findings
+}
+
+// keywordOffsets returns the sorted offsets in [from, to) at which one of
+// keywords occurs in data, ignoring ASCII case if fold is set.
+func keywordOffsets(data []byte, keywords []string, fold bool, from, to int) []int {
+	index := bytes.Index
+	if fold {
+		index = indexFold
+	}
+	var offsets []int
+	for _, kw := range keywords {
+		k := []byte(kw)
+		for pos := from; pos < to; {
+			i := index(data[pos:], k)
+			if i < 0 || pos+i >= to {
+				break
+			}
+			offsets = append(offsets, pos+i)
+			pos += i + 1
+		}
+	}
+	if len(keywords) > 1 {
+		sort.Ints(offsets)
+	}
+	return offsets
+}
+
+// indexFold is bytes.Index ignoring the ASCII case of the non-empty sep.
+func indexFold(s, sep []byte) int {
+	first := string([]byte{lower(sep[0]), upper(sep[0])})
+	for i := 0; len(s)-i >= len(sep); i++ {
+		j := bytes.IndexAny(s[i:], first)
+		if j < 0 {
+			return -1
+		}
+		i += j
+		if len(s)-i < len(sep) {
+			return -1
+		}
+		if asciiEqualFold(s[i:i+len(sep)], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+func asciiEqualFold(a, b []byte) bool {
+	for i := range a {
+		if lower(a[i]) != lower(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func lower(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+func upper(b byte) byte {
+	if 'a' <= b && b <= 'z' {
+		return b - 'a' + 'A'
+	}
+	return b
+}
+
+func isWord(b byte) bool {
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
@@ -0,0 +1,87 @@
+package secrets
+
+import "io"
+
+const (
+	// MaxMatchLen bounds the length of a match. Streams keep this many
+	// bytes of one chunk to find secrets continuing into the next.
+	MaxMatchLen = 4096
+	// DefaultChunkSize is the amount of new data scanned at once.
+	DefaultChunkSize = 64 << 10
+)
+
+// Stream scans data written to it in bounded memory, whatever the size of
+// the stream or of the individual writes.
+type Stream struct {
+	s  *Scanner
+	fn func(Finding)
+
+	buf []byte
+	// base is the stream offset of buf[0]; done is the stream offset up to
+	// which matches have been reported.
+	base, done int
+}
+
+// NewStream returns a stream calling fn, in offset order, for every finding.
+// chunkSize is the amount of data scanned at once, DefaultChunkSize if it
+// is below 2.
+func (s *Scanner) NewStream(chunkSize int, fn func(Finding)) *Stream {
+	if chunkSize < 2 {
+		chunkSize = DefaultChunkSize
+	}
+	return &Stream{s: s, fn: fn, buf: make([]byte, 0, chunkSize+MaxMatchLen)}
+}
+
+// Write implements io.Writer. It never fails.
+func (st *Stream) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		free := cap(st.buf) - len(st.buf)
+		if free > len(p) {
+			free = len(p)
+		}
+		st.buf = append(st.buf, p[:free]...)
+		p = p[free:]
+		if len(st.buf) == cap(st.buf) {
+			st.flush(false)
+		}
+	}
+	return n, nil
+}
+
+// Close scans the remaining data.
+func (st *Stream) Close() error {
+	st.flush(true)
+	return nil
+}
+
+func (st *Stream) flush(final bool) {
+	limit := len(st.buf)
+	if !final {
+		limit -= MaxMatchLen
+	}
+	for _, f := range st.s.scan(st.buf, st.base, st.done-st.base, limit) {
+		st.fn(f)
+	}
+	st.done = st.base + limit
+	if final {
+		return
+	}
+	// Keep the unreported tail plus one byte so that \b at the start of
+	// the next window sees the preceding character.
+	drop := limit - 1
+	n := copy(st.buf, st.buf[drop:])
+	st.buf = st.buf[:n]
+	st.base += drop
+}
+
+// ScanReader returns the secrets read from r, ordered by offset.
+func (s *Scanner) ScanReader(r io.Reader) ([]Finding, error) {
+	var findings []Finding
+	st := s.NewStream(0, func(f Finding) { findings = append(findings, f) })
+	buf := make([]byte, 32<<10)
+	if _, err := io.CopyBuffer(st, r, buf); err != nil {
+		return findings, err
+	}
+	return findings, st.Close()
+}
@@ -0,0 +1,110 @@
+package secrets
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// liveToken is a well-formed token with a valid checksum, so every scan
+// reports it.
+var liveToken = githubToken("ghp_", "R7mPq2vLx9KdT4nWc8ZbHy3JfGs6Ae")
+
+// filler returns n bytes of text that contains no secrets.
+func filler(rng *rand.Rand, n int) []byte {
+	const alphabet = "abcdefghij klmnop,.{}\"\n"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[rng.Intn(len(alphabet))]
+	}
+	return b
+}
+
+func TestStreamBoundaries(t *testing.T) {
+	token := githubToken("ghp_", "R7mPq2vLx9KdT4nWc8ZbHy3JfGs6Ae")
+	rng := rand.New(rand.NewSource(1))
+	s := New()
+	for _, chunk := range []int{2, 7, 40, 1000} {
+		var data bytes.Buffer
+		for i := 0; i < 20; i++ {
+			data.Write(filler(rng, rng.Intn(3*chunk)))
+			data.WriteString(" " + token + " ")
+		}
+		want := s.Scan(data.Bytes())
+		require.Len(t, want, 20)
+
+		var got []Finding
+		st := s.NewStream(chunk, func(f Finding) { got = append(got, f) })
+		for _, b := range data.Bytes() {
+			st.Write([]byte{b})
+		}
+		require.NoError(t, st.Close())
+		require.Equal(t, want, got, "chunk %d", chunk)
+	}
+}
+
+func TestStreamWordBoundary(t *testing.T) {
+	// The x before the token must still be seen across a chunk boundary.
+	data := strings.Repeat(" ", 9) + "x" + githubToken("ghp_", "R7mPq2vLx9KdT4nWc8ZbHy3JfGs6Ae")
+	var got []Finding
+	st := New().NewStream(10, func(f Finding) { got = append(got, f) })
+	st.Write([]byte(data))
+	st.Close()
+	require.Empty(t, got)
+}
+
+func TestScanReader(t *testing.T) {
+	token := githubToken("ghp_", "R7mPq2vLx9KdT4nWc8ZbHy3JfGs6Ae")
+	data := strings.Repeat("a", DefaultChunkSize-10) + " " + token + " " + strings.Repeat("b", 3*DefaultChunkSize)
+	findings, err := New().ScanReader(iotest.HalfReader(strings.NewReader(data)))
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, DefaultChunkSize-9, findings[0].Offset)
+	require.Equal(t, High, findings[0].Confidence)
+}
+
+func TestScanReaderError(t *testing.T) {
+	_, err := New().ScanReader(iotest.ErrReader(iotest.ErrTimeout))
+	require.ErrorIs(t, err, iotest.ErrTimeout)
+}
+
+func benchmarkData(size int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	data := filler(rng, size)
+	// One secret per 64 KiB, roughly what a leaky artifact upload holds.
+	for off := 1000; off+len(liveToken) < size; off += 64 << 10 {
+		copy(data[off:], " "+liveToken+" ")
+	}
+	return data
+}
+
+func BenchmarkScan(b *testing.B) {
+	data := benchmarkData(4 << 20)
+	s := New()
+	if len(s.Scan(data)) != 64 {
+		b.Fatal("benchmark data should hold a secret per 64 KiB")
+	}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Scan(data)
+	}
+}
+
+func BenchmarkScanReader(b *testing.B) {
+	data := benchmarkData(4 << 20)
+	s := New()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.ScanReader(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+	"inivisirisk.com/demo/demo/ca"
+	"inivisirisk.com/demo/demo/mock"
+)
+
+var mockOpts struct {
+	listen string
+	record string
+	caOut  string
+	hosts  []string
+}
+
+var serveMockCmd = &cobra.Command{
+	Use:   "serve-mock",
+	Short: "Run a local stand-in for the PSE control API",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		authority, err := ca.New("PSE Mock CA")
+		if err != nil {
+			return err
+		}
+		if mockOpts.caOut != "" {
+			if err := os.WriteFile(mockOpts.caOut, authority.CertPEM(), 0o644); err != nil {
+				return err
+			}
+		}
+		leaf, err := authority.Leaf(mockOpts.hosts...)
+		if err != nil {
+			return err
+		}
+		srv, err := mock.NewServer(authority, mockOpts.record)
+		if err != nil {
+			return err
+		}
+
+		hs := &http.Server{
+			Addr:      mockOpts.listen,
+			Handler:   srv.Handler(),
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{*leaf}},
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "serving PSE mock on https://%s\n", mockOpts.listen)
+		return hs.ListenAndServeTLS("", "")
+	},
+}
+
+func init() {
+	serveMockCmd.Flags().StringVar(&mockOpts.listen, "listen", "127.0.0.1:8443", "address to listen on")
+	serveMockCmd.Flags().StringVar(&mockOpts.record, "record", "pse-sessions.json", "file the sessions are recorded to")
+	serveMockCmd.Flags().StringVar(&mockOpts.caOut, "ca-out", "", "also write the generated CA certificate to this file")
+	serveMockCmd.Flags().StringSliceVar(&mockOpts.hosts, "host", []string{"pse.invisirisk.com", "pse", "localhost", "127.0.0.1"}, "names the server certificate is issued for")
+	rootCmd.AddCommand(serveMockCmd)
+}
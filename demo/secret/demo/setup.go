@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"inivisirisk.com/demo/demo/iptables"
+	"inivisirisk.com/demo/demo/pse"
+)
+
+var setupOpts struct {
+	proxyHost string
+	proxyPort int
+	smbPort   int
+	smbRelay  string
+	ports     []int
+	egress    string
+	allow     []string
+	install   bool
+	dryRun    bool
+	caFile    string
+}
+
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Redirect build traffic to the PSE proxy",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ip, ip6, err := resolveProxy(setupOpts.proxyHost)
+		if err != nil {
+			return err
+		}
+		egress, err := iptables.ParseEgress(setupOpts.egress)
+		if err != nil {
+			return err
+		}
+		cfg := iptables.DefaultConfig(ip, ip6)
+		cfg.ProxyPort = setupOpts.proxyPort
+		cfg.SMBPort = setupOpts.smbPort
+		relay := setupOpts.smbRelay
+		if relay == "" {
+			relay = net.JoinHostPort(setupOpts.proxyHost, strconv.Itoa(iptables.DefaultSMBPort))
+		}
+		if cfg.SMBPort != 0 {
+			_, port, err := net.SplitHostPort(relay)
+			if err != nil {
+				return fmt.Errorf("smb relay %q: %w", relay, err)
+			}
+			if cfg.SMBRelayPort, err = strconv.Atoi(port); err != nil {
+				return fmt.Errorf("smb relay %q: bad port", relay)
+			}
+		}
+		cfg.Ports = setupOpts.ports
+		cfg.Egress = egress
+		cfg.DNS = nameservers(resolvConf)
+		cfg.Allow = setupOpts.allow
+		if cfg.Egress == iptables.EgressReject && len(cfg.DNS) == 0 {
+			return fmt.Errorf("no name server in %s to exempt from --egress reject, allow the resolver with --allow", resolvConf)
+		}
+
+		if setupOpts.dryRun {
+			for _, f := range iptables.Families {
+				for _, rule := range iptables.SetupRules(cfg, f, iptables.State{}) {
+					fmt.Fprintln(cmd.OutOrStdout(), f, strings.Join(rule, " "))
+				}
+			}
+			return nil
+		}
+
+		if setupOpts.install {
+			if err := installPackages(); err != nil {
+				return err
+			}
+		}
+
+		// Keep the state of an earlier setup so a second run does not
+		// mistake our own changes for the original configuration.
+		st, err := loadState(statePath)
+		if errors.Is(err, os.ErrNotExist) {
+			st = &setupState{}
+		} else if err != nil {
+			return err
+		}
+		st.Chain = cfg.Chain
+		// Without IPv6 routes there is nothing to redirect or block. With
+		// them, IPv6 egress that cannot be managed would bypass the proxy.
+		st.IPv6 = iptables.Available(iptables.Exec{Path: string(iptables.IPv6)})
+		if !st.IPv6 {
+			routed, err := ipv6Routed(ipv6Routes)
+			if err != nil {
+				return err
+			}
+			if routed {
+				return fmt.Errorf("the host routes IPv6 but ip6tables is unavailable, install it or disable IPv6")
+			}
+			fmt.Fprintln(cmd.ErrOrStderr(), "the host has no IPv6 routes, leaving IPv6 alone")
+		}
+		if err := st.save(statePath); err != nil {
+			return err
+		}
+		if st.SMBForwarder != 0 {
+			if err := stopProcess(st.SMBForwarder); err != nil {
+				return err
+			}
+			st.SMBForwarder = 0
+		}
+		if cfg.SMBPort != 0 {
+			if st.SMBForwarder, err = startForwarder(cfg.SMBPort, relay, st.IPv6); err != nil {
+				return err
+			}
+		}
+		if err := st.save(statePath); err != nil {
+			return err
+		}
+		for _, f := range st.families() {
+			run := iptables.Exec{Path: string(f), Stdout: cmd.OutOrStdout(), Stderr: cmd.ErrOrStderr()}
+			probe := iptables.Probe(iptables.Exec{Path: string(f)}, cfg.Chain)
+			if err := iptables.Apply(run, iptables.SetupRules(cfg, f, probe)); err != nil {
+				return err
+			}
+		}
+		return installCA(cmd, st)
+	},
+}
+
+func init() {
+	setupCmd.Flags().StringVar(&setupOpts.proxyHost, "proxy-host", "pse", "host name of the PSE service")
+	setupCmd.Flags().IntVar(&setupOpts.proxyPort, "proxy-port", iptables.DefaultProxyPort, "port of the PSE proxy")
+	setupCmd.Flags().IntVar(&setupOpts.smbPort, "smb-port", 0, "local port TCP 445 is redirected to for the SMB forwarder, 0 to leave SMB alone")
+	setupCmd.Flags().StringVar(&setupOpts.smbRelay, "smb-relay", "", fmt.Sprintf("address of the PSE SMB relay (default proxy host, port %d)", iptables.DefaultSMBPort))
+	setupCmd.Flags().IntSliceVar(&setupOpts.ports, "ports", []int{80, 443}, "TCP ports redirected to the PSE proxy")
+	setupCmd.Flags().StringVar(&setupOpts.egress, "egress", string(iptables.EgressLog), "policy for other egress: allow, log or reject")
+	setupCmd.Flags().StringSliceVar(&setupOpts.allow, "allow", nil, "addresses or CIDR blocks exempt from the egress policy")
+	setupCmd.Flags().BoolVar(&setupOpts.install, "install", true, "install iptables, ca-certificates and git")
+	setupCmd.Flags().BoolVar(&setupOpts.dryRun, "dry-run", false, "print the rules instead of installing them")
+	setupCmd.Flags().StringVar(&setupOpts.caFile, "ca-file", "/etc/ssl/certs/pse.pem", "where to install the PSE CA certificate")
+	rootCmd.AddCommand(setupCmd)
+}
+
+// installCA trusts the PSE CA system wide, for git and for node, recording
+// each change in st before making it.
+func installCA(cmd *cobra.Command, st *setupState) error {
+	cert, err := pse.NewClient(pseURL).FetchCA(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	caFile := setupOpts.caFile
+	if st.CAFile == "" {
+		old, err := os.ReadFile(caFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		st.CAExisted, st.CABackup = err == nil, old
+		st.CAFile = caFile
+		if err := st.save(statePath); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(caFile, cert, 0o644); err != nil {
+		return err
+	}
+	if err := runCommand(cmd, "update-ca-certificates"); err != nil {
+		return err
+	}
+
+	if !st.GitConfigured {
+		if out, err := exec.Command("git", "config", "--global", "--get", "http.sslCAInfo").Output(); err == nil {
+			prev := strings.TrimSpace(string(out))
+			st.GitCAInfo = &prev
+		}
+		st.GitConfigured = true
+		if err := st.save(statePath); err != nil {
+			return err
+		}
+	}
+	if err := runCommand(cmd, "git", "config", "--global", "http.sslCAInfo", caFile); err != nil {
+		return err
+	}
+
+	if st.EnvFile == "" {
+		st.EnvFile, st.EnvLine = os.Getenv("GITHUB_ENV"), "NODE_EXTRA_CA_CERTS="+caFile
+		if st.EnvFile == "" {
+			st.EnvFile, st.EnvLine = "/etc/profile.d/pse.sh", "export "+st.EnvLine
+		}
+		if err := st.save(statePath); err != nil {
+			return err
+		}
+		return appendLine(st.EnvFile, st.EnvLine)
+	}
+	return nil
+}
+
+func runCommand(cmd *cobra.Command, name string, args ...string) error {
+	c := exec.Command(name, args...)
+	c.Stdout = cmd.OutOrStdout()
+	c.Stderr = cmd.ErrOrStderr()
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// resolveProxy returns the IPv4 and IPv6 address of host, either of which
+// may be nil but not both.
+func resolveProxy(host string) (net.IP, net.IP, error) {
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		if ips, err = net.LookupIP(host); err != nil {
+			return nil, nil, fmt.Errorf("resolving proxy %s: %w", host, err)
+		}
+	}
+	ip, ip6 := proxyAddrs(ips)
+	if ip == nil && ip6 == nil {
+		return nil, nil, fmt.Errorf("proxy %s has no usable address", host)
+	}
+	return ip, ip6, nil
+}
+
+// proxyAddrs picks the first IPv4 and the first IPv6 address of ips.
+// Link-local IPv6 addresses are skipped since a DNAT target cannot carry
+// their zone.
+func proxyAddrs(ips []net.IP) (ip, ip6 net.IP) {
+	for _, a := range ips {
+		switch {
+		case a.To4() != nil:
+			if ip == nil {
+				ip = a.To4()
+			}
+		case a.IsLinkLocalUnicast():
+		case ip6 == nil:
+			ip6 = a
+		}
+	}
+	return ip, ip6
+}
+
+const resolvConf = "/etc/resolv.conf"
+
+// nameservers returns the name servers listed in the resolv.conf at path,
+// or nil if it cannot be read.
+func nameservers(path string) []net.IP {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		if ip := net.ParseIP(fields[1]); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+const ipv6Routes = "/proc/net/ipv6_route"
+
+// ipv6Routed reports whether the kernel routing table at path has an IPv6
+// route beyond the loopback interface, link-local and multicast addresses,
+// which every interface gets. The table is missing when IPv6 is disabled.
+func ipv6Routed(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 10 || fields[9] == "lo" {
+			continue
+		}
+		if dest := fields[0]; !strings.HasPrefix(dest, "fe80") && !strings.HasPrefix(dest, "ff") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// installPackages installs the tools setup relies on with apt-get, or apk on
+// Alpine images.
+func installPackages() error {
+	pkgs := []string{"iptables", "ca-certificates", "git"}
+	var cmds [][]string
+	if _, err := exec.LookPath("apt-get"); err == nil {
+		cmds = [][]string{
+			{"apt-get", "update"},
+			append([]string{"apt-get", "install", "-y"}, pkgs...),
+		}
+	} else {
+		// Alpine packages ip6tables separately.
+		cmds = [][]string{append([]string{"apk", "add", "ip6tables"}, pkgs...)}
+	}
+	for _, c := range cmds {
+		cmd := exec.Command(c[0], c[1:]...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			os.Stderr.Write(out)
+			return fmt.Errorf("%s: %w", strings.Join(c, " "), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameservers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(t, os.WriteFile(path, []byte("# generated\nsearch corp.example\nnameserver 127.0.0.53\nnameserver  168.63.129.16 \noptions edns0\n"), 0o644))
+	require.Equal(t, []net.IP{net.ParseIP("127.0.0.53"), net.ParseIP("168.63.129.16")}, nameservers(path))
+	require.Nil(t, nameservers(filepath.Join(t.TempDir(), "missing")))
+}
+
+func TestIPv6Routed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipv6_route")
+	local := "00000000000000000000000000000001 80 00000000000000000000000000000000 00 00000000000000000000000000000000 00000000 00000002 00000000 80200001       lo\n" +
+		"fe800000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000002 00000000 00000001     eth0\n" +
+		"ff000000000000000000000000000000 08 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000004 00000000 00000001     eth0\n"
+	require.NoError(t, os.WriteFile(path, []byte(local), 0o644))
+	routed, err := ipv6Routed(path)
+	require.NoError(t, err)
+	require.False(t, routed)
+
+	eth := "fd001800000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0\n"
+	require.NoError(t, os.WriteFile(path, []byte(local+eth), 0o644))
+	routed, err = ipv6Routed(path)
+	require.NoError(t, err)
+	require.True(t, routed)
+
+	routed, err = ipv6Routed(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	require.False(t, routed)
+}
+
+func TestProxyAddrs(t *testing.T) {
+	ip, ip6 := proxyAddrs([]net.IP{net.ParseIP("fe80::1"), net.ParseIP("fd00:18::2"), net.ParseIP("172.18.0.2"), net.ParseIP("172.18.0.3")})
+	require.Equal(t, net.IP{172, 18, 0, 2}, ip)
+	require.Equal(t, net.ParseIP("fd00:18::2"), ip6)
+
+	ip, ip6 = proxyAddrs([]net.IP{net.ParseIP("172.18.0.2")})
+	require.Equal(t, net.IP{172, 18, 0, 2}, ip)
+	require.Nil(t, ip6)
+
+	ip, ip6 = proxyAddrs([]net.IP{net.ParseIP("fe80::1"), net.ParseIP("fd00:18::2")})
+	require.Nil(t, ip)
+	require.Equal(t, net.ParseIP("fd00:18::2"), ip6)
+}
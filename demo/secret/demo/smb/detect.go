@@ -0,0 +1,158 @@
+package smb
+
+import (
+	"bytes"
+
+	"inivisirisk.com/demo/demo/event"
+)
+
+// NTLM message types.
+const (
+	ntlmNegotiate    = 1
+	ntlmChallenge    = 2
+	ntlmAuthenticate = 3
+)
+
+// Detector is an io.Writer receiving the bytes a client sends to an SMB
+// server. It emits a session event for each NTLM authentication, with the
+// user, and a connect event for each tree connect, with the share.
+// Kerberos sessions carry no readable user, and requests of SMB 3 sessions
+// that encrypt are not visible at all.
+type Detector struct {
+	// Server is the address the client connected to, reported until a tree
+	// connect names the server.
+	Server string
+	// Emit receives the events.
+	Emit func(*event.Event)
+
+	buf  []byte
+	skip int
+	user event.SMBDetails
+}
+
+// Write implements io.Writer. It never fails: the stream is passed on
+// whether or not it parses.
+func (d *Detector) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if d.skip > 0 {
+			k := d.skip
+			if k > len(p) {
+				k = len(p)
+			}
+			d.skip -= k
+			p = p[k:]
+			continue
+		}
+		d.buf = append(d.buf, p...)
+		p = nil
+		for len(d.buf) >= 4 {
+			size := int(be.Uint32(d.buf) & 0xffffff)
+			if size > maxMessage {
+				rest := d.buf[4:]
+				if len(rest) >= size {
+					d.buf = rest[size:]
+					continue
+				}
+				d.skip = size - len(rest)
+				d.buf = d.buf[:0]
+				break
+			}
+			if len(d.buf) < 4+size {
+				break
+			}
+			// A non zero first byte is a NetBIOS session message,
+			// e.g. a keep alive.
+			if d.buf[0] == 0 {
+				d.message(d.buf[4 : 4+size])
+			}
+			d.buf = d.buf[4+size:]
+		}
+	}
+	return n, nil
+}
+
+// message handles a transport message, which holds one request or a
+// compound chain of them.
+func (d *Detector) message(msg []byte) {
+	for len(msg) >= headerSize {
+		if !bytes.Equal(msg[:4], protocolID) {
+			// SMB1 or an encrypted transform.
+			return
+		}
+		next := int(le.Uint32(msg[20:]))
+		if next != 0 && (next < headerSize || next%8 != 0) {
+			// Chained messages start on 8 byte boundaries after a
+			// whole header; anything else is malformed.
+			return
+		}
+		pkt := msg
+		if next > 0 && next <= len(msg) {
+			pkt = msg[:next]
+		}
+		if le.Uint32(pkt[16:])&flagServerToRedir == 0 {
+			switch le.Uint16(pkt[12:]) {
+			case cmdSessionSetup:
+				d.sessionSetup(pkt)
+			case cmdTreeConnect:
+				d.treeConnect(pkt)
+			}
+		}
+		if next <= 0 || next > len(msg) {
+			return
+		}
+		msg = msg[next:]
+	}
+}
+
+func (d *Detector) sessionSetup(pkt []byte) {
+	body := pkt[headerSize:]
+	if len(body) < 24 {
+		return
+	}
+	sec := buffer(pkt, int(le.Uint16(body[12:])), int(le.Uint16(body[14:])))
+	m, typ := ntlmMessage(sec)
+	if typ != ntlmAuthenticate || len(m) < 64 {
+		return
+	}
+	unicode := le.Uint32(m[60:])&1 != 0
+	field := func(off int) string {
+		b := buffer(m, int(le.Uint32(m[off+4:])), int(le.Uint16(m[off:])))
+		if unicode {
+			return decodeUTF16(b)
+		}
+		return string(b)
+	}
+	d.user = event.SMBDetails{
+		Domain:      field(28),
+		User:        field(36),
+		Workstation: field(44),
+	}
+	s := d.user
+	s.Server = d.Server
+	d.emit(event.New("session", &s))
+}
+
+func (d *Detector) treeConnect(pkt []byte) {
+	body := pkt[headerSize:]
+	if len(body) < 8 {
+		return
+	}
+	path := buffer(pkt, int(le.Uint16(body[4:])), int(le.Uint16(body[6:])))
+	server, share := splitPath(decodeUTF16(path))
+	if share == "" {
+		return
+	}
+	c := d.user
+	c.Server, c.Share = server, share
+	if c.Server == "" {
+		c.Server = d.Server
+	}
+	d.emit(event.New("connect", &c))
+}
+
+func (d *Detector) emit(e *event.Event) {
+	if d.Emit != nil {
+		d.Emit(e)
+	}
+}
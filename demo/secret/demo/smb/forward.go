@@ -0,0 +1,48 @@
+package smb
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// Forwarder runs in the network namespace of the build, where the pse chain
+// redirects TCP 445 to it, and passes each connection on to a Relay. Only
+// here can the original destination be looked up; it is sent to the relay
+// in a PROXY protocol header.
+type Forwarder struct {
+	// Relay is the address of the Relay.
+	Relay string
+}
+
+// Serve forwards the connections accepted on ln until it fails.
+func (f *Forwarder) Serve(ln net.Listener) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go f.forward(c)
+	}
+}
+
+func (f *Forwarder) forward(c net.Conn) {
+	defer c.Close()
+	dest, err := originalDst(c)
+	if err != nil {
+		return
+	}
+	dst, err := net.ResolveTCPAddr("tcp", dest)
+	if err != nil {
+		return
+	}
+	up, err := net.DialTimeout("tcp", f.Relay, 10*time.Second)
+	if err != nil {
+		return
+	}
+	defer up.Close()
+	if _, err := io.WriteString(up, proxyHeader(c.RemoteAddr().(*net.TCPAddr), dst)); err != nil {
+		return
+	}
+	pipe(c, up, io.Discard)
+}
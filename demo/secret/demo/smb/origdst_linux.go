@@ -0,0 +1,64 @@
+package smb
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// soOriginalDst is SO_ORIGINAL_DST from linux/netfilter_ipv4.h, which
+// linux/netfilter_ipv6.h reuses as IP6T_SO_ORIGINAL_DST.
+const soOriginalDst = 80
+
+// originalDst returns the address c was sent to before the nat table
+// redirected it.
+func originalDst(c net.Conn) (string, error) {
+	tc, ok := c.(*net.TCPConn)
+	if !ok {
+		return "", errors.New("smb: original destination needs a TCP connection")
+	}
+	raw, err := tc.SyscallConn()
+	if err != nil {
+		return "", err
+	}
+	local, _ := tc.LocalAddr().(*net.TCPAddr)
+	v6 := local != nil && local.IP.To4() == nil
+	var (
+		addr    string
+		sockErr error
+	)
+	err = raw.Control(func(fd uintptr) {
+		if v6 {
+			// ip6tables answers with a sockaddr_in6, which is the head of
+			// an ip6_mtuinfo.
+			info, err := syscall.GetsockoptIPv6MTUInfo(int(fd), syscall.IPPROTO_IPV6, soOriginalDst)
+			if err != nil {
+				sockErr = err
+				return
+			}
+			p := (*[2]byte)(unsafe.Pointer(&info.Addr.Port))
+			ip := net.IP(info.Addr.Addr[:])
+			addr = net.JoinHostPort(ip.String(), strconv.Itoa(int(p[0])<<8|int(p[1])))
+			return
+		}
+		// The sockaddr_in result fits the 16 byte multiaddr of an
+		// ipv6_mreq: family, big endian port, address.
+		mreq, err := syscall.GetsockoptIPv6Mreq(int(fd), syscall.IPPROTO_IP, soOriginalDst)
+		if err != nil {
+			sockErr = err
+			return
+		}
+		a := mreq.Multiaddr
+		port := int(a[2])<<8 | int(a[3])
+		addr = net.JoinHostPort(net.IPv4(a[4], a[5], a[6], a[7]).String(), strconv.Itoa(port))
+	})
+	if err != nil {
+		return "", err
+	}
+	if sockErr != nil {
+		return "", sockErr
+	}
+	return addr, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package smb
+
+import (
+	"errors"
+	"net"
+)
+
+// originalDst needs the Linux nat table, so a Forwarder only works on
+// Linux.
+func originalDst(c net.Conn) (string, error) {
+	return "", errors.New("smb: original destination is only known on Linux")
+}
@@ -0,0 +1,153 @@
+package smb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"inivisirisk.com/demo/demo/event"
+)
+
+// Relay forwards SMB connections to their destination, passing what the
+// client sends through a Detector. The destination is taken from the PROXY
+// protocol header a Forwarder sends ahead of each connection. Like the
+// proxy, the relay must run outside the network namespace of the build or
+// its own connections to port 445 are redirected back to it.
+type Relay struct {
+	// Upstream receives every connection instead of the destination in
+	// the PROXY header, which clients then do not send.
+	Upstream string
+	// Log receives the events of each connection with the client address.
+	Log func(client string, e *event.Event)
+
+	// dial connects upstream; tests replace it.
+	dial func(addr string) (net.Conn, error)
+}
+
+// Serve relays the connections accepted on ln until it fails.
+func (r *Relay) Serve(ln net.Listener) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go r.relay(c)
+	}
+}
+
+func (r *Relay) relay(c net.Conn) {
+	defer c.Close()
+	client, dest := c.RemoteAddr().String(), r.Upstream
+	if dest == "" {
+		c.SetReadDeadline(time.Now().Add(10 * time.Second))
+		src, dst, err := readProxyHeader(c)
+		if err != nil || !smbPort(dst) || selfAddressed(c, dst) {
+			return
+		}
+		c.SetReadDeadline(time.Time{})
+		client, dest = src, dst
+	}
+	dial := r.dial
+	if dial == nil {
+		dial = func(addr string) (net.Conn, error) { return net.DialTimeout("tcp", addr, 10*time.Second) }
+	}
+	up, err := dial(dest)
+	if err != nil {
+		return
+	}
+	defer up.Close()
+
+	server, _, _ := net.SplitHostPort(dest)
+	d := &Detector{Server: server, Emit: func(e *event.Event) {
+		e.Time = time.Now()
+		if r.Log != nil {
+			r.Log(client, e)
+		}
+	}}
+	pipe(c, up, d)
+}
+
+// smbPort reports whether dest is on the SMB port, so the relay cannot be
+// pointed at other services on the network.
+func smbPort(dest string) bool {
+	_, port, _ := net.SplitHostPort(dest)
+	return port == strconv.Itoa(Port)
+}
+
+// selfAddressed reports whether dest is the relay itself, which a client
+// could name to have the relay connect to itself in a loop.
+func selfAddressed(c net.Conn, dest string) bool {
+	host, _, _ := net.SplitHostPort(dest)
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+	local, ok := c.LocalAddr().(*net.TCPAddr)
+	return ok && local.IP.Equal(ip)
+}
+
+// pipe copies between client and server until both are done, passing what
+// the client sends to tee as well.
+func pipe(client, server net.Conn, tee io.Writer) {
+	done := make(chan struct{})
+	go func() {
+		io.Copy(client, server)
+		closeWrite(client)
+		close(done)
+	}()
+	io.Copy(server, io.TeeReader(client, tee))
+	closeWrite(server)
+	<-done
+}
+
+func closeWrite(c net.Conn) {
+	if tc, ok := c.(*net.TCPConn); ok {
+		tc.CloseWrite()
+	} else {
+		c.Close()
+	}
+}
+
+// maxProxyHeader is the longest PROXY protocol version 1 header.
+const maxProxyHeader = 107
+
+// proxyHeader returns the PROXY protocol version 1 header of a connection
+// from src to dst.
+func proxyHeader(src, dst *net.TCPAddr) string {
+	proto := "TCP4"
+	if src.IP.To4() == nil || dst.IP.To4() == nil {
+		proto = "TCP6"
+	}
+	return fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, src.IP, dst.IP, src.Port, dst.Port)
+}
+
+// readProxyHeader reads a PROXY protocol version 1 header from r, a byte
+// at a time so that nothing after it is consumed, and returns the source
+// and destination addresses.
+func readProxyHeader(r io.Reader) (src, dst string, err error) {
+	var line []byte
+	b := make([]byte, 1)
+	for !strings.HasSuffix(string(line), "\r\n") {
+		if len(line) == maxProxyHeader {
+			return "", "", errors.New("smb: PROXY header too long")
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", "", err
+		}
+		line = append(line, b[0])
+	}
+	f := strings.Fields(string(line))
+	if len(f) != 6 || f[0] != "PROXY" || (f[1] != "TCP4" && f[1] != "TCP6") {
+		return "", "", fmt.Errorf("smb: invalid PROXY header %q", line)
+	}
+	for _, port := range f[4:] {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return "", "", fmt.Errorf("smb: invalid PROXY header %q", line)
+		}
+	}
+	return net.JoinHostPort(f[2], f[4]), net.JoinHostPort(f[3], f[5]), nil
+}
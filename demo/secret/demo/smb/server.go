@@ -0,0 +1,251 @@
+package smb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Status codes.
+const (
+	statusSuccess                = 0x00000000
+	statusMoreProcessingRequired = 0xc0000016
+	statusNotSupported           = 0xc00000bb
+	statusBadNetworkName         = 0xc00000cc
+)
+
+const (
+	dialect210 = 0x0210
+
+	sessionFlagIsGuest = 0x0001
+	shareTypeDisk      = 0x01
+)
+
+// NTLM negotiate flags the challenge adds to the client's.
+const (
+	ntlmRequestTarget    = 0x00000004
+	ntlmTargetTypeServer = 0x00020000
+	ntlmTargetInfo       = 0x00800000
+)
+
+var nlmpOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}
+
+// Server is a stand-in SMB 2.1 file server. It accepts any NTLM credentials
+// as a guest session and lets clients connect to Shares, which are empty;
+// anything beyond connecting is answered with STATUS_NOT_SUPPORTED.
+type Server struct {
+	// Name is the NetBIOS name in NTLM challenges, PSE if empty.
+	Name   string
+	Shares []string
+
+	sessions uint64
+}
+
+// Serve answers the connections accepted on ln until it fails.
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer c.Close()
+			s.ServeConn(c)
+		}()
+	}
+}
+
+// ServeConn answers the requests on c until the client disconnects or sends
+// something other than SMB2.
+func (s *Server) ServeConn(c net.Conn) error {
+	var sessionID uint64
+	for {
+		req, err := readMessage(c)
+		if err != nil {
+			return err
+		}
+		if len(req) < headerSize || !bytes.Equal(req[:4], protocolID) {
+			return fmt.Errorf("smb: not an SMB2 request")
+		}
+		status, body := uint32(statusSuccess), []byte(nil)
+		var treeID uint32
+		switch le.Uint16(req[12:]) {
+		case cmdNegotiate:
+			status, body = s.negotiate(req)
+		case cmdSessionSetup:
+			if sessionID == 0 {
+				sessionID = atomic.AddUint64(&s.sessions, 1)
+			}
+			status, body = s.sessionSetup(req)
+		case cmdTreeConnect:
+			status, body, treeID = s.treeConnect(req)
+		case cmdLogoff, cmdTreeDisconnect, cmdEcho:
+			body = []byte{4, 0, 0, 0}
+		default:
+			status = statusNotSupported
+		}
+		if status != statusSuccess && status != statusMoreProcessingRequired {
+			// ERROR response: StructureSize 9 and one byte of error data.
+			body = []byte{9, 0, 0, 0, 0, 0, 0, 0, 0}
+		}
+		if treeID == 0 {
+			treeID = le.Uint32(req[36:])
+		}
+		if err := writeMessage(c, response(req, status, sessionID, treeID, body)); err != nil {
+			return err
+		}
+	}
+}
+
+// response builds the reply to req, granting the credits it asked for.
+func response(req []byte, status uint32, sessionID uint64, treeID uint32, body []byte) []byte {
+	res := make([]byte, headerSize+len(body))
+	copy(res, req[:48]) // up to the signature
+	le.PutUint32(res[8:], status)
+	credits := le.Uint16(req[14:])
+	if credits == 0 {
+		credits = 1
+	}
+	le.PutUint16(res[14:], credits)
+	le.PutUint32(res[16:], flagServerToRedir)
+	le.PutUint32(res[20:], 0)
+	le.PutUint32(res[36:], treeID)
+	le.PutUint64(res[40:], sessionID)
+	copy(res[headerSize:], body)
+	return res
+}
+
+func (s *Server) negotiate(req []byte) (uint32, []byte) {
+	body := req[headerSize:]
+	if len(body) < 36 {
+		return statusNotSupported, nil
+	}
+	dialects := buffer(body, 36, 2*int(le.Uint16(body[2:])))
+	offered := false
+	for i := 0; i+2 <= len(dialects); i += 2 {
+		offered = offered || le.Uint16(dialects[i:]) == dialect210
+	}
+	if !offered {
+		return statusNotSupported, nil
+	}
+	res := make([]byte, 64)
+	le.PutUint16(res[0:], 65)
+	le.PutUint16(res[2:], 1) // signing enabled, not required
+	le.PutUint16(res[4:], dialect210)
+	copy(res[8:24], "pse-smb-standin!")
+	le.PutUint32(res[28:], maxMessage)
+	le.PutUint32(res[32:], maxMessage)
+	le.PutUint32(res[36:], maxMessage)
+	le.PutUint64(res[40:], filetime(time.Now()))
+	le.PutUint16(res[56:], headerSize+64)
+	return statusSuccess, res
+}
+
+// negTokenResp is the SPNEGO NegTokenResp of RFC 4178.
+type negTokenResp struct {
+	NegState      asn1.Enumerated       `asn1:"explicit,tag:0"`
+	SupportedMech asn1.ObjectIdentifier `asn1:"explicit,optional,tag:1"`
+	ResponseToken []byte                `asn1:"explicit,optional,tag:2"`
+}
+
+func (s *Server) sessionSetup(req []byte) (uint32, []byte) {
+	body := req[headerSize:]
+	if len(body) < 24 {
+		return statusNotSupported, nil
+	}
+	sec := buffer(req, int(le.Uint16(body[12:])), int(le.Uint16(body[14:])))
+	m, typ := ntlmMessage(sec)
+	var (
+		status uint32
+		token  negTokenResp
+	)
+	switch typ {
+	case ntlmNegotiate:
+		status = statusMoreProcessingRequired
+		// accept-incomplete
+		token = negTokenResp{NegState: 1, SupportedMech: nlmpOID, ResponseToken: s.challenge(m)}
+	case ntlmAuthenticate:
+		// accept-completed
+		status, token = statusSuccess, negTokenResp{NegState: 0}
+	default:
+		return statusNotSupported, nil
+	}
+	out, err := asn1.MarshalWithParams(token, "explicit,tag:1")
+	if err != nil {
+		return statusNotSupported, nil
+	}
+	res := make([]byte, 8+len(out))
+	le.PutUint16(res[0:], 9)
+	le.PutUint16(res[2:], sessionFlagIsGuest)
+	le.PutUint16(res[4:], headerSize+8)
+	le.PutUint16(res[6:], uint16(len(out)))
+	copy(res[8:], out)
+	return status, res
+}
+
+// challenge returns the NTLM CHALLENGE message answering negotiate.
+func (s *Server) challenge(negotiate []byte) []byte {
+	name := s.Name
+	if name == "" {
+		name = "PSE"
+	}
+	target := encodeUTF16(name)
+	var info []byte
+	for _, id := range []uint16{1, 2} { // MsvAvNbComputerName, MsvAvNbDomainName
+		pair := make([]byte, 4, 4+len(target))
+		le.PutUint16(pair[0:], id)
+		le.PutUint16(pair[2:], uint16(len(target)))
+		info = append(info, append(pair, target...)...)
+	}
+	info = append(info, 0, 0, 0, 0) // MsvAvEOL
+
+	var flags uint32
+	if len(negotiate) >= 16 {
+		flags = le.Uint32(negotiate[12:])
+	}
+	flags |= ntlmRequestTarget | ntlmTargetTypeServer | ntlmTargetInfo
+
+	const off = 56
+	m := make([]byte, off, off+len(target)+len(info))
+	copy(m, ntlmssp)
+	le.PutUint32(m[8:], ntlmChallenge)
+	le.PutUint16(m[12:], uint16(len(target)))
+	le.PutUint16(m[14:], uint16(len(target)))
+	le.PutUint32(m[16:], off)
+	le.PutUint32(m[20:], flags)
+	rand.Read(m[24:32])
+	le.PutUint16(m[40:], uint16(len(info)))
+	le.PutUint16(m[42:], uint16(len(info)))
+	le.PutUint32(m[44:], uint32(off+len(target)))
+	copy(m[48:], []byte{6, 1, 0, 0, 0, 0, 0, 15}) // Windows 7, NTLM revision 15
+	return append(append(m, target...), info...)
+}
+
+func (s *Server) treeConnect(req []byte) (uint32, []byte, uint32) {
+	body := req[headerSize:]
+	if len(body) < 8 {
+		return statusNotSupported, nil, 0
+	}
+	path := buffer(req, int(le.Uint16(body[4:])), int(le.Uint16(body[6:])))
+	_, share := splitPath(decodeUTF16(path))
+	for i, name := range s.Shares {
+		if strings.EqualFold(name, share) {
+			res := make([]byte, 16)
+			le.PutUint16(res[0:], 16)
+			res[2] = shareTypeDisk
+			le.PutUint32(res[12:], 0x001f01ff) // full access
+			return statusSuccess, res, uint32(i + 1)
+		}
+	}
+	return statusBadNetworkName, nil, 0
+}
+
+// filetime converts t to Windows FILETIME, 100ns intervals since 1601.
+func filetime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100) + 116444736000000000
+}
@@ -0,0 +1,121 @@
+// Package smb makes SMB2 traffic on port 445 visible to PSE. A Detector
+// turns the client side of a connection into session and connect events, a
+// Relay forwards connections redirected by the pse chain through a Detector,
+// and Server is a stand-in file server to exercise both without a real one.
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Port is the SMB direct TCP port.
+const Port = 445
+
+// maxMessage bounds the messages buffered by Detector and Server. Session
+// setup and tree connect requests are far smaller; larger messages are reads
+// and writes, which are skipped.
+const maxMessage = 64 << 10
+
+const headerSize = 64
+
+// Commands.
+const (
+	cmdNegotiate      = 0x0000
+	cmdSessionSetup   = 0x0001
+	cmdLogoff         = 0x0002
+	cmdTreeConnect    = 0x0003
+	cmdTreeDisconnect = 0x0004
+	cmdEcho           = 0x000d
+)
+
+// Header flags.
+const (
+	flagServerToRedir = 0x00000001
+)
+
+var (
+	protocolID = []byte{0xfe, 'S', 'M', 'B'}
+	ntlmssp    = []byte("NTLMSSP\x00")
+)
+
+var (
+	le = binary.LittleEndian
+	be = binary.BigEndian
+)
+
+// readMessage reads one message framed by a direct TCP transport header: a
+// zero byte and a 24 bit big endian length.
+func readMessage(r io.Reader) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	size := be.Uint32(hdr[:])
+	if hdr[0] != 0 || size > maxMessage {
+		return nil, fmt.Errorf("smb: bad transport header %x", hdr)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func writeMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 4+len(msg))
+	be.PutUint32(buf, uint32(len(msg)))
+	copy(buf[4:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+// buffer returns the length bytes at offset off of msg, or nil if they are
+// out of bounds.
+func buffer(msg []byte, off, length int) []byte {
+	if off < 0 || length < 0 || off+length > len(msg) {
+		return nil
+	}
+	return msg[off : off+length]
+}
+
+// decodeUTF16 decodes little endian UTF-16 as used for SMB2 and NTLM
+// strings.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = le.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+func encodeUTF16(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		le.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+// splitPath splits a tree connect path \\server\share.
+func splitPath(path string) (server, share string) {
+	path = strings.TrimPrefix(path, `\\`)
+	server, share, _ = strings.Cut(path, `\`)
+	return server, share
+}
+
+// ntlmMessage returns the NTLMSSP message inside a security buffer, which
+// is usually wrapped in SPNEGO, and its type.
+func ntlmMessage(buf []byte) ([]byte, uint32) {
+	i := bytes.Index(buf, ntlmssp)
+	if i < 0 || len(buf) < i+12 {
+		return nil, 0
+	}
+	m := buf[i:]
+	return m, le.Uint32(m[8:])
+}
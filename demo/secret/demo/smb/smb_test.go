@@ -0,0 +1,211 @@
+package smb
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hirochachacha/go-smb2"
+	"github.com/stretchr/testify/require"
+	"inivisirisk.com/demo/demo/event"
+)
+
+func listen(t *testing.T, serve func(net.Listener) error) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go serve(ln)
+	return ln.Addr().String()
+}
+
+// recorder collects events from concurrent connections.
+type recorder struct {
+	mu      sync.Mutex
+	clients []string
+	events  []*event.Event
+}
+
+func (r *recorder) log(client string, e *event.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients = append(r.clients, client)
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) titles() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var titles []string
+	for _, e := range r.events {
+		titles = append(titles, e.Title())
+	}
+	return titles
+}
+
+// teeConn copies what the client sends to w.
+type teeConn struct {
+	net.Conn
+	w io.Writer
+}
+
+func (c teeConn) Write(p []byte) (int, error) {
+	c.w.Write(p)
+	return c.Conn.Write(p)
+}
+
+func dial(t *testing.T, addr, user string, sent io.Writer) *smb2.Session {
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	d := &smb2.Dialer{Initiator: &smb2.NTLMInitiator{User: user, Password: "secret", Domain: "CORP"}}
+	s, err := d.Dial(teeConn{c, sent})
+	require.NoError(t, err)
+	return s
+}
+
+func TestRelay(t *testing.T) {
+	server := listen(t, (&Server{Shares: []string{"public"}}).Serve)
+	rec := &recorder{}
+	relay := listen(t, (&Relay{Upstream: server, Log: rec.log}).Serve)
+
+	s := dial(t, relay, "builder", io.Discard)
+	share, err := s.Mount(`\\files.corp.example\public`)
+	require.NoError(t, err)
+	require.NoError(t, share.Umount())
+	_, err = s.Mount("private")
+	require.Error(t, err)
+	require.NoError(t, s.Logoff())
+
+	// The relay passes requests on after detecting them, so the events are
+	// in by the time the responses arrive.
+	require.Equal(t, []string{
+		"smb - session - 127.0.0.1",
+		`smb - connect - \\files.corp.example\public`,
+		`smb - connect - \\` + relay + `\private`,
+	}, rec.titles())
+	require.Equal(t, &event.SMBDetails{Server: "files.corp.example", Share: "public", User: "builder", Domain: "CORP"}, rec.events[1].Details)
+	require.False(t, rec.events[0].Time.IsZero())
+}
+
+func TestRelayProxyHeader(t *testing.T) {
+	server := listen(t, (&Server{Shares: []string{"public"}}).Serve)
+	rec := &recorder{}
+	dialed := make(chan string, 1)
+	relay := listen(t, (&Relay{Log: rec.log, dial: func(addr string) (net.Conn, error) {
+		dialed <- addr
+		return net.Dial("tcp", server)
+	}}).Serve)
+
+	c, err := net.Dial("tcp", relay)
+	require.NoError(t, err)
+	_, err = io.WriteString(c, "PROXY TCP4 10.1.0.7 192.0.2.10 50123 445\r\n")
+	require.NoError(t, err)
+	s, err := (&smb2.Dialer{Initiator: &smb2.NTLMInitiator{User: "builder"}}).Dial(c)
+	require.NoError(t, err)
+	_, err = s.Mount(`\\files.corp.example\public`)
+	require.NoError(t, err)
+	require.NoError(t, s.Logoff())
+
+	require.Equal(t, "192.0.2.10:445", <-dialed)
+	require.Equal(t, []string{"smb - session - 192.0.2.10", `smb - connect - \\files.corp.example\public`}, rec.titles())
+	require.Equal(t, "10.1.0.7:50123", rec.clients[0])
+}
+
+func TestRelayRejectsSelf(t *testing.T) {
+	dialed := make(chan string, 4)
+	relay := listen(t, (&Relay{dial: func(addr string) (net.Conn, error) {
+		dialed <- addr
+		return nil, io.EOF
+	}}).Serve)
+	for _, header := range []string{
+		"PROXY TCP4 10.1.0.7 127.0.0.1 50123 445\r\n",
+		"PROXY TCP6 fd00::7 :: 50123 445\r\n",
+		"PROXY TCP4 10.1.0.7 192.0.2.10 50123 6379\r\n",
+		"GET / HTTP/1.1\r\n",
+	} {
+		c, err := net.Dial("tcp", relay)
+		require.NoError(t, err)
+		_, err = io.WriteString(c, header)
+		require.NoError(t, err)
+		_, err = c.Read(make([]byte, 1))
+		require.Equal(t, io.EOF, err, header)
+		c.Close()
+	}
+	require.Empty(t, dialed)
+}
+
+func TestProxyHeader(t *testing.T) {
+	for _, tc := range [][2]*net.TCPAddr{
+		{{IP: net.IPv4(10, 1, 0, 7), Port: 50123}, {IP: net.IPv4(192, 0, 2, 10), Port: 445}},
+		{{IP: net.ParseIP("fd00::7"), Port: 50123}, {IP: net.ParseIP("2001:db8::10"), Port: 445}},
+	} {
+		r := strings.NewReader(proxyHeader(tc[0], tc[1]) + "SMB")
+		src, dst, err := readProxyHeader(r)
+		require.NoError(t, err)
+		require.Equal(t, tc[0].String(), src)
+		require.Equal(t, tc[1].String(), dst)
+		require.Equal(t, 3, r.Len())
+	}
+}
+
+func TestDetectorFragmented(t *testing.T) {
+	server := listen(t, (&Server{Shares: []string{"public"}}).Serve)
+	var sent bytes.Buffer
+	s := dial(t, server, "builder", &sent)
+	_, err := s.Mount("public")
+	require.NoError(t, err)
+	require.NoError(t, s.Logoff())
+
+	var got []*event.Event
+	d := &Detector{Server: "10.0.0.5", Emit: func(e *event.Event) { got = append(got, e) }}
+	stream := sent.Bytes()
+	for i := range stream {
+		d.Write(stream[i : i+1])
+	}
+	require.Len(t, got, 2)
+	require.Equal(t, event.New("session", &event.SMBDetails{Server: "10.0.0.5", User: "builder", Domain: "CORP"}), got[0])
+	require.Equal(t, event.New("connect", &event.SMBDetails{Server: server, Share: "public", User: "builder", Domain: "CORP"}), got[1])
+}
+
+func TestDetectorSkipsLargeMessages(t *testing.T) {
+	var got []*event.Event
+	d := &Detector{Emit: func(e *event.Event) { got = append(got, e) }}
+	big := make([]byte, 4+maxMessage+1)
+	be.PutUint32(big, maxMessage+1)
+	d.Write(big[:100])
+	d.Write(big[100:])
+	d.Write(treeConnectRequest(`\\srv\data`))
+	require.Len(t, got, 1)
+	require.Equal(t, `\\srv\data`, got[0].Details.Target())
+}
+
+func TestDetectorShortChain(t *testing.T) {
+	var got []*event.Event
+	d := &Detector{Emit: func(e *event.Event) { got = append(got, e) }}
+	for _, next := range []uint32{8, 68} {
+		msg := make([]byte, 4+headerSize)
+		be.PutUint32(msg, headerSize)
+		copy(msg[4:], protocolID)
+		le.PutUint32(msg[4+20:], next)
+		d.Write(msg)
+	}
+	d.Write(treeConnectRequest(`\\srv\data`))
+	require.Len(t, got, 1)
+}
+
+func treeConnectRequest(path string) []byte {
+	p := encodeUTF16(path)
+	msg := make([]byte, headerSize+8, headerSize+8+len(p))
+	copy(msg, protocolID)
+	le.PutUint16(msg[4:], headerSize)
+	le.PutUint16(msg[12:], cmdTreeConnect)
+	le.PutUint16(msg[headerSize:], 9)
+	le.PutUint16(msg[headerSize+4:], headerSize+8)
+	le.PutUint16(msg[headerSize+6:], uint16(len(p)))
+	msg = append(msg, p...)
+	framed := make([]byte, 4, 4+len(msg))
+	be.PutUint32(framed, uint32(len(msg)))
+	return append(framed, msg...)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+	"github.com/spf13/cobra"
+	"inivisirisk.com/demo/demo/event"
+	"inivisirisk.com/demo/demo/smb"
+)
+
+var smbOpts struct {
+	server string
+	share  string
+	user   string
+}
+
+// smbDemo attempts an SMB2 session and mounts a share. Without --smb-server
+// the server is a stand-in served in process and reached through an SMB
+// relay, whose events are printed; with it, the connection goes to port 445
+// where the pse chain redirects it to smb-forward if setup ran with
+// --smb-port.
+func smbDemo(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+	addr := smbOpts.server
+	var (
+		mu     sync.Mutex
+		events []*event.Event
+	)
+	if addr == "" {
+		standIn, err := serveLocal((&smb.Server{Shares: []string{smbOpts.share}}).Serve)
+		if err != nil {
+			return err
+		}
+		defer standIn.Close()
+		relay, err := serveLocal((&smb.Relay{Upstream: standIn.Addr().String(), Log: func(client string, e *event.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		}}).Serve)
+		if err != nil {
+			return err
+		}
+		defer relay.Close()
+		addr = relay.Addr().String()
+	} else if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, strconv.Itoa(smb.Port))
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	d := &smb2.Dialer{Initiator: &smb2.NTLMInitiator{User: smbOpts.user}}
+	s, err := d.Dial(conn)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smb session with %s: %w", addr, err)
+	}
+	share, err := s.Mount(smbOpts.share)
+	if err == nil {
+		fmt.Fprintf(out, "mounted %s on %s as %s\n", smbOpts.share, addr, smbOpts.user)
+		err = share.Umount()
+	}
+	s.Logoff()
+	if err != nil {
+		return fmt.Errorf("smb share %s: %w", smbOpts.share, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	enc := json.NewEncoder(out)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serveLocal serves on a loopback port in the background.
+func serveLocal(serve func(net.Listener) error) (net.Listener, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	go serve(ln)
+	return ln, nil
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&smbOpts.server, "smb-server", "", "SMB server to connect to, a local stand-in if empty")
+	rootCmd.Flags().StringVar(&smbOpts.share, "smb-share", "public", "SMB share to mount")
+	rootCmd.Flags().StringVar(&smbOpts.user, "smb-user", "guest", "NTLM user of the SMB session")
+}
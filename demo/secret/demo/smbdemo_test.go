@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMBDemo(t *testing.T) {
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetArgs([]string{"--smb-share", "builds", "--smb-user", "runner"})
+	defer rootCmd.SetArgs(nil)
+	require.NoError(t, rootCmd.Execute())
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	require.Regexp(t, `^mounted builds on 127\.0\.0\.1:\d+ as runner$`, lines[0])
+	require.Contains(t, lines[1], `"type":"smb","action":"session"`)
+	require.Contains(t, lines[1], `"user":"runner"`)
+	require.Contains(t, lines[2], `"action":"connect"`)
+	require.Contains(t, lines[2], `"share":"builds"`)
+}
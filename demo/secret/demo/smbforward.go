@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"inivisirisk.com/demo/demo/smb"
+)
+
+var smbForwardOpts struct {
+	listen []string
+	relay  string
+}
+
+var smbForwardCmd = &cobra.Command{
+	Use:   "smb-forward",
+	Short: "Pass SMB connections redirected by the pse chain on to the PSE SMB relay",
+	Long: `Pass SMB connections redirected by the pse chain on to the PSE SMB relay.
+
+The original destination of a connection is only known in the network
+namespace of the build, so the forwarder runs there and names it in a PROXY
+protocol header. setup --smb-port starts it in the background.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f := &smb.Forwarder{Relay: smbForwardOpts.relay}
+		errc := make(chan error, len(smbForwardOpts.listen))
+		for _, addr := range smbForwardOpts.listen {
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "forwarding SMB from %s to %s\n", ln.Addr(), f.Relay)
+			go func() { errc <- f.Serve(ln) }()
+		}
+		return <-errc
+	},
+}
+
+func init() {
+	smbForwardCmd.Flags().StringSliceVar(&smbForwardOpts.listen, "listen", nil, "addresses the pse chain redirects TCP 445 to")
+	smbForwardCmd.Flags().StringVar(&smbForwardOpts.relay, "relay", "", "address of the PSE SMB relay")
+	smbForwardCmd.MarkFlagRequired("listen")
+	smbForwardCmd.MarkFlagRequired("relay")
+	rootCmd.AddCommand(smbForwardCmd)
+}
+
+// startForwarder runs smb-forward in the background, listening on port of
+// the loopback addresses, and returns its process id once it accepts
+// connections.
+func startForwarder(port int, relay string, ipv6 bool) (int, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	args := []string{"smb-forward", "--relay", relay, "--listen", addr}
+	if ipv6 {
+		args = append(args, "--listen", net.JoinHostPort("::1", strconv.Itoa(port)))
+	}
+	logPath := filepath.Join(filepath.Dir(statePath), "smb-forward.log")
+	log, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer log.Close()
+	c := exec.Command(self, args...)
+	c.Stdout, c.Stderr = log, log
+	if err := c.Start(); err != nil {
+		return 0, err
+	}
+	pid := c.Process.Pid
+	c.Process.Release()
+
+	for i := 0; i < 50; i++ {
+		if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+			conn.Close()
+			return pid, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	stopProcess(pid)
+	return 0, fmt.Errorf("smb forwarder did not start, see %s", logPath)
+}
+
+// procDir is where the command lines of running processes are read.
+var procDir = "/proc"
+
+// stopProcess stops the process pid if it is still a forwarder. A forwarder
+// that exited long ago may have left its pid to an unrelated process.
+func stopProcess(pid int) error {
+	if !isForwarder(pid) {
+		return nil
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+	if err := p.Signal(syscall.SIGTERM); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
+}
+
+// isForwarder reports whether pid runs this binary's smb-forward command.
+func isForwarder(pid int) bool {
+	cmdline, err := os.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return false
+	}
+	args := strings.Split(string(cmdline), "\x00")
+	self, err := os.Executable()
+	if err != nil || len(args) < 2 {
+		return false
+	}
+	return filepath.Base(args[0]) == filepath.Base(self) && args[1] == "smb-forward"
+}
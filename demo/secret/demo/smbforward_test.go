@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsForwarder(t *testing.T) {
+	defer func(dir string) { procDir = dir }(procDir)
+	procDir = t.TempDir()
+	self, err := os.Executable()
+	require.NoError(t, err)
+	for pid, cmdline := range map[string]string{
+		"100": self + "\x00smb-forward\x00--relay\x00pse:12445\x00--listen\x00127.0.0.1:12446\x00",
+		"101": "/usr/sbin/sshd\x00-D\x00",
+		"102": self + "\x00proxy\x00",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(procDir, pid), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(procDir, pid, "cmdline"), []byte(cmdline), 0o644))
+	}
+	require.True(t, isForwarder(100))
+	require.False(t, isForwarder(101))
+	require.False(t, isForwarder(102))
+	require.False(t, isForwarder(103))
+	// A pid that is not a forwarder is left alone.
+	require.NoError(t, stopProcess(101))
+}
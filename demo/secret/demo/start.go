@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"inivisirisk.com/demo/demo/ci"
+	"inivisirisk.com/demo/demo/pse"
+)
+
+var buildOpts struct {
+	builder string
+	dryRun  bool
+	status  string
+}
+
+var startCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Open a PSE session for this build",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := builder(buildOpts.builder)
+		if err != nil {
+			return err
+		}
+		info := b.Info(os.Getenv)
+		if buildOpts.dryRun {
+			printForm(cmd.OutOrStdout(), info.Form())
+			return nil
+		}
+		return pse.NewClient(pseURL).Start(cmd.Context(), info)
+	},
+}
+
+var endCmd = &cobra.Command{
+	Use:   "end",
+	Short: "Close the PSE session for this build",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := builder(buildOpts.builder)
+		if err != nil {
+			return err
+		}
+		res := pse.BuildResult{
+			BuildURL: b.Info(os.Getenv).BuildURL,
+			Status:   buildOpts.status,
+		}
+		if res.Status == "" {
+			res.Status = b.Status(os.Getenv)
+		}
+		if buildOpts.dryRun {
+			printForm(cmd.OutOrStdout(), res.Form())
+			return nil
+		}
+		return pse.NewClient(pseURL).End(cmd.Context(), res)
+	},
+}
+
+func init() {
+	for _, c := range []*cobra.Command{startCmd, endCmd} {
+		c.Flags().StringVar(&buildOpts.builder, "builder", "", "CI system, one of "+strings.Join(ci.Names(), ", ")+" (detected if empty)")
+		c.Flags().BoolVar(&buildOpts.dryRun, "dry-run", false, "print the form instead of sending it")
+		rootCmd.AddCommand(c)
+	}
+	endCmd.Flags().StringVar(&buildOpts.status, "status", "", "build status (taken from the CI environment if empty)")
+}
+
+func builder(name string) (ci.Builder, error) {
+	if name != "" {
+		b, ok := ci.Lookup(name)
+		if !ok {
+			return b, fmt.Errorf("unknown builder %q, expected one of %s", name, strings.Join(ci.Names(), ", "))
+		}
+		return b, nil
+	}
+	b, ok := ci.Detect(os.Getenv)
+	if !ok {
+		return b, fmt.Errorf("could not detect the CI system, use --builder")
+	}
+	return b, nil
+}
+
+func printForm(w io.Writer, form url.Values) {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s=%s\n", k, form.Get(k))
+	}
+}
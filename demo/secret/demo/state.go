@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"inivisirisk.com/demo/demo/iptables"
+)
+
+const defaultStatePath = "/var/lib/pse/setup.json"
+
+// setupState records every change setup made to the build host so that
+// teardown can revert exactly those changes.
+type setupState struct {
+	Chain string `json:"chain,omitempty"`
+	// IPv6 is set when the chain was installed with ip6tables as well.
+	IPv6 bool `json:"ipv6,omitempty"`
+	// SMBForwarder is the process id of the smb-forward started by setup.
+	SMBForwarder int `json:"smb_forwarder,omitempty"`
+
+	CAFile string `json:"ca_file,omitempty"`
+	// CAExisted is set if there was a file at CAFile before, and CABackup
+	// holds its contents, which may be empty.
+	CAExisted bool   `json:"ca_existed,omitempty"`
+	CABackup  []byte `json:"ca_backup,omitempty"`
+
+	GitConfigured bool `json:"git_configured,omitempty"`
+	// GitCAInfo is the previous global http.sslCAInfo; nil if it was unset.
+	GitCAInfo *string `json:"git_ca_info,omitempty"`
+
+	EnvFile string `json:"env_file,omitempty"`
+	EnvLine string `json:"env_line,omitempty"`
+}
+
+// families returns the address families the chain was installed in.
+func (s *setupState) families() []iptables.Family {
+	if s.IPv6 {
+		return iptables.Families
+	}
+	return []iptables.Family{iptables.IPv4}
+}
+
+func loadState(path string) (*setupState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	st := &setupState{}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("parsing state %s: %w", path, err)
+	}
+	return st, nil
+}
+
+func (s *setupState) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// appendLine appends line to the file at path, creating it if needed.
+func appendLine(path, line string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// removeLine removes every occurrence of line from the file at path. The file
+// is deleted if nothing else is left in it.
+func removeLine(path, line string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var kept []string
+	for _, l := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if l != line {
+			kept = append(kept, l)
+		}
+	}
+	if len(kept) == 0 || (len(kept) == 1 && kept[0] == "") {
+		return os.Remove(path)
+	}
+	return os.WriteFile(path, []byte(strings.Join(kept, "\n")+"\n"), 0o644)
+}
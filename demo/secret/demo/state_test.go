@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pse", "setup.json")
+	prev := "/etc/ssl/certs/corp.pem"
+	st := &setupState{
+		Chain:         "pse",
+		CAFile:        "/etc/ssl/certs/pse.pem",
+		CAExisted:     true,
+		CABackup:      []byte("old"),
+		GitConfigured: true,
+		GitCAInfo:     &prev,
+		EnvFile:       "/etc/profile.d/pse.sh",
+		EnvLine:       "export NODE_EXTRA_CA_CERTS=/etc/ssl/certs/pse.pem",
+	}
+	require.NoError(t, st.save(path))
+	got, err := loadState(path)
+	require.NoError(t, err)
+	require.Equal(t, st, got)
+
+	// An empty CA file still existed.
+	st = &setupState{CAFile: "/etc/ssl/certs/pse.pem", CAExisted: true}
+	require.NoError(t, st.save(path))
+	got, err = loadState(path)
+	require.NoError(t, err)
+	require.True(t, got.CAExisted)
+}
+
+func TestRemoveLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env")
+	require.NoError(t, os.WriteFile(path, []byte("A=1\n"), 0o644))
+	require.NoError(t, appendLine(path, "NODE_EXTRA_CA_CERTS=/x"))
+	require.NoError(t, removeLine(path, "NODE_EXTRA_CA_CERTS=/x"))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "A=1\n", string(data))
+
+	require.NoError(t, removeLine(path, "A=1"))
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestRestoreFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pse.pem")
+	require.NoError(t, os.WriteFile(path, []byte("pse"), 0o644))
+	require.NoError(t, restoreFile(path, []byte("orig"), true))
+	data, _ := os.ReadFile(path)
+	require.Equal(t, "orig", string(data))
+
+	// An empty file is restored, not removed.
+	require.NoError(t, restoreFile(path, nil, true))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Empty(t, data)
+
+	require.NoError(t, restoreFile(path, nil, false))
+	require.NoError(t, restoreFile(path, nil, false))
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
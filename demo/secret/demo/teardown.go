@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"inivisirisk.com/demo/demo/iptables"
+)
+
+var teardownCmd = &cobra.Command{
+	Use:   "teardown",
+	Short: "Revert the changes made by setup",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		st, err := loadState(statePath)
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(cmd.ErrOrStderr(), "no setup state at %s, nothing to tear down\n", statePath)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Every step is attempted even if an earlier one failed, so a
+		// reused runner is left as clean as possible.
+		failed := 0
+		step := func(name string, err error) {
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "teardown %s: %v\n", name, err)
+				failed++
+			}
+		}
+
+		if st.Chain != "" {
+			cfg := iptables.Config{Chain: st.Chain}
+			for _, f := range st.families() {
+				run := iptables.Exec{Path: string(f), Stdout: cmd.OutOrStdout(), Stderr: cmd.ErrOrStderr()}
+				probe := iptables.Probe(iptables.Exec{Path: string(f)}, st.Chain)
+				step(string(f), iptables.Apply(run, iptables.TeardownRules(cfg, probe)))
+			}
+		}
+		if st.SMBForwarder != 0 {
+			step("smb forwarder", stopProcess(st.SMBForwarder))
+		}
+		if st.CAFile != "" {
+			step("ca file", restoreFile(st.CAFile, st.CABackup, st.CAExisted))
+			step("trust store", runCommand(cmd, "update-ca-certificates"))
+		}
+		if st.GitConfigured {
+			if st.GitCAInfo != nil {
+				step("git config", runCommand(cmd, "git", "config", "--global", "http.sslCAInfo", *st.GitCAInfo))
+			} else {
+				step("git config", runCommand(cmd, "git", "config", "--global", "--unset", "http.sslCAInfo"))
+			}
+		}
+		if st.EnvFile != "" {
+			step("env", removeLine(st.EnvFile, st.EnvLine))
+			// GITHUB_ENV is consumed after every step; clear the variable
+			// for the steps that follow.
+			if gh := os.Getenv("GITHUB_ENV"); gh != "" {
+				step("env", appendLine(gh, "NODE_EXTRA_CA_CERTS="))
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("teardown incomplete: %d steps failed, state kept in %s", failed, statePath)
+		}
+		return os.Remove(statePath)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(teardownCmd)
+}
+
+// restoreFile puts back the previous contents of path, or removes it if it
+// did not exist before.
+func restoreFile(path string, backup []byte, existed bool) error {
+	if existed {
+		return os.WriteFile(path, backup, 0o644)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}